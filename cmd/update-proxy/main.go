@@ -32,7 +32,6 @@ func main() {
 	}
 
 	defer logger.Sync()
-	app := proxy.NewOpenShiftUpdateProxy(cfg, logger.Sugar())
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT, syscall.SIGKILL, syscall.SIGHUP)
 	defer stop()
@@ -47,6 +46,11 @@ func main() {
 		cancel() // Cancel global context when signals are received
 	}()
 
+	app, err := proxy.NewOpenShiftUpdateProxy(globalContext, cfg, logger.Sugar())
+	if err != nil {
+		logger.Fatal(fmt.Sprintf("cannot initialize proxy: %s", err.Error()))
+	}
+
 	err = app.Run(globalContext)
 	if err != nil && err != http.ErrServerClosed {
 		logger.Fatal(fmt.Sprintf("got runtime error: %s", err.Error()))
@@ -0,0 +1,115 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lukeelten/openshift-update-proxy/pkg/config"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+const REDACTED = "<redacted>"
+
+// UpstreamAuth adds the configured headers and credentials to upstream requests.
+type UpstreamAuth struct {
+	headers  http.Header
+	username string
+	password string
+	token    *tokenFile
+}
+
+// tokenFile caches the content of a bearer token file until the file changes.
+type tokenFile struct {
+	name string
+
+	lock    sync.Mutex
+	version fileVersion
+	token   string
+}
+
+func NewUpstreamAuth(cfg config.UpstreamConfig) *UpstreamAuth {
+	auth := &UpstreamAuth{
+		headers:  make(http.Header, len(cfg.Headers)),
+		username: cfg.Auth.Username,
+		password: cfg.Auth.Password,
+	}
+
+	for name, value := range cfg.Headers {
+		auth.headers.Set(name, value)
+	}
+
+	if len(cfg.Auth.BearerTokenFile) > 0 {
+		auth.token = &tokenFile{name: cfg.Auth.BearerTokenFile}
+	}
+
+	return auth
+}
+
+func (auth *UpstreamAuth) Apply(req *http.Request) error {
+	for name, values := range auth.headers {
+		req.Header[name] = values
+	}
+
+	if auth.token != nil {
+		token, err := auth.token.get()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if len(auth.username) > 0 {
+		req.SetBasicAuth(auth.username, auth.password)
+	}
+
+	return nil
+}
+
+func (token *tokenFile) get() (string, error) {
+	info, err := os.Stat(token.name)
+	if err != nil {
+		return "", fmt.Errorf("cannot read bearer token file: %w", err)
+	}
+	version := fileVersion{modTime: info.ModTime(), size: info.Size()}
+
+	token.lock.Lock()
+	defer token.lock.Unlock()
+
+	if len(token.token) > 0 && version.equal(token.version) {
+		return token.token, nil
+	}
+
+	data, err := os.ReadFile(token.name)
+	if err != nil {
+		return "", fmt.Errorf("cannot read bearer token file: %w", err)
+	}
+
+	value := strings.TrimSpace(string(data))
+	if len(value) == 0 {
+		return "", errors.New("bearer token file is empty")
+	}
+
+	token.token = value
+	token.version = version
+	return value, nil
+}
+
+// redactHeaders returns a copy of the headers which is safe to log. Credentials and all configured static
+// headers are replaced, as they are likely to contain secrets as well.
+func (auth *UpstreamAuth) redactHeaders(header http.Header) http.Header {
+	redacted := header.Clone()
+	for name := range redacted {
+		if _, ok := auth.headers[name]; ok || isSensitiveHeader(name) {
+			redacted[name] = []string{REDACTED}
+		}
+	}
+	return redacted
+}
+
+func isSensitiveHeader(name string) bool {
+	switch http.CanonicalHeaderKey(name) {
+	case "Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/lukeelten/openshift-update-proxy/pkg/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testToken    = "secret-token"
+	testPassword = "secret-password"
+)
+
+func writeTokenFile(t *testing.T, name string, token string, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(name, []byte(token+"\n"), 0600); err != nil {
+		t.Fatalf("cannot write token file: %v", err)
+	}
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatalf("cannot set token file time: %v", err)
+	}
+}
+
+// containsSecret reports whether the secret appears in the headers, either in plain or base64 encoded
+func containsSecret(header http.Header, secret string) bool {
+	encoded := base64.StdEncoding.EncodeToString([]byte("user:" + secret))
+	for _, values := range header {
+		for _, value := range values {
+			if strings.Contains(value, secret) || strings.Contains(value, encoded) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestRedactHeaders(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	writeTokenFile(t, tokenFile, testToken, time.Now())
+
+	tests := []struct {
+		name   string
+		auth   config.AuthConfig
+		secret string
+	}{
+		{name: "bearer token", auth: config.AuthConfig{BearerTokenFile: tokenFile}, secret: testToken},
+		{name: "basic auth", auth: config.AuthConfig{Username: "user", Password: testPassword}, secret: testPassword},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth := NewUpstreamAuth(config.UpstreamConfig{
+				Auth:    test.auth,
+				Headers: map[string]string{"X-Api-Key": "secret-key"},
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "https://example.com/graph", nil)
+			request.Header.Set("Accept", "application/json")
+			request.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("user:"+test.secret)))
+			request.Header.Set("Cookie", "session="+test.secret)
+			if err := auth.Apply(request); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !containsSecret(request.Header, test.secret) {
+				t.Fatal("credentials not applied")
+			}
+
+			redacted := auth.redactHeaders(request.Header)
+			if containsSecret(redacted, test.secret) || containsSecret(redacted, "secret-key") {
+				t.Errorf("secret not redacted: %v", redacted)
+			}
+			for _, name := range []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"} {
+				if value := redacted.Get(name); value != REDACTED {
+					t.Errorf("expected %s to be redacted, got %q", name, value)
+				}
+			}
+			if value := redacted.Get("Accept"); value != "application/json" {
+				t.Errorf("expected Accept to be kept, got %q", value)
+			}
+
+			// the request itself is not modified
+			if !containsSecret(request.Header, test.secret) {
+				t.Error("redaction modified the request headers")
+			}
+		})
+	}
+}
+
+func TestRedactedLogs(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	writeTokenFile(t, tokenFile, testToken, time.Now())
+
+	tests := []struct {
+		name   string
+		auth   config.AuthConfig
+		secret string
+	}{
+		{name: "bearer token", auth: config.AuthConfig{BearerTokenFile: tokenFile}, secret: testToken},
+		{name: "basic auth", auth: config.AuthConfig{Username: "user", Password: testPassword}, secret: testPassword},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(&statusUpstream{status: http.StatusForbidden, failures: 1})
+			t.Cleanup(server.Close)
+
+			core, logs := observer.New(zapcore.DebugLevel)
+			upstream, err := NewUpstreamClient(zap.New(core).Sugar(), newTestMetrics(), config.UpstreamConfig{
+				Name:           "test",
+				Endpoints:      []string{server.URL},
+				Timeout:        time.Second,
+				Auth:           test.auth,
+				Retry:          config.RetryConfig{MaxAttempts: 1, Deadline: time.Second},
+				CircuitBreaker: config.CircuitBreakerConfig{FailureThreshold: 100, OpenDuration: time.Minute},
+			})
+			if err != nil {
+				t.Fatalf("cannot create upstream client: %v", err)
+			}
+
+			if _, err := upstream.loadWithRetry(context.Background(), "amd64", "stable-4.14", "4.14.1", "", ""); err == nil {
+				t.Fatal("expected error")
+			}
+			if logs.FilterMessage("got error response").Len() == 0 {
+				t.Fatal("error response not logged")
+			}
+
+			encoded := base64.StdEncoding.EncodeToString([]byte("user:" + test.secret))
+			for _, entry := range logs.All() {
+				logged := fmt.Sprintf("%s %v", entry.Message, entry.ContextMap())
+				if strings.Contains(logged, test.secret) || strings.Contains(logged, encoded) {
+					t.Errorf("secret logged: %s", logged)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenFileReload(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	modTime := time.Now().Add(-time.Hour)
+	writeTokenFile(t, tokenFile, "first-token", modTime)
+
+	auth := NewUpstreamAuth(config.UpstreamConfig{Auth: config.AuthConfig{BearerTokenFile: tokenFile}})
+
+	authorization := func() string {
+		t.Helper()
+
+		request := httptest.NewRequest(http.MethodGet, "https://example.com/graph", nil)
+		if err := auth.Apply(request); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return request.Header.Get("Authorization")
+	}
+
+	if value := authorization(); value != "Bearer first-token" {
+		t.Fatalf("expected first token, got %q", value)
+	}
+
+	// a rotated token of the same length is detected by the modification time
+	writeTokenFile(t, tokenFile, "other-token", modTime.Add(time.Second))
+	if value := authorization(); value != "Bearer other-token" {
+		t.Errorf("expected rotated token, got %q", value)
+	}
+
+	// a token of a different length is detected by the size, even with the same modification time
+	writeTokenFile(t, tokenFile, "longer-rotated-token", modTime.Add(time.Second))
+	if value := authorization(); value != "Bearer longer-rotated-token" {
+		t.Errorf("expected rotated token, got %q", value)
+	}
+
+	// an empty or removed token file fails the request instead of sending a stale token
+	writeTokenFile(t, tokenFile, "", modTime.Add(2*time.Second))
+	if err := auth.Apply(httptest.NewRequest(http.MethodGet, "https://example.com/graph", nil)); err == nil {
+		t.Error("expected error for empty token file")
+	}
+	if err := os.Remove(tokenFile); err != nil {
+		t.Fatalf("cannot remove token file: %v", err)
+	}
+	if err := auth.Apply(httptest.NewRequest(http.MethodGet, "https://example.com/graph", nil)); err == nil {
+		t.Error("expected error for missing token file")
+	}
+}
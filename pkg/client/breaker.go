@@ -0,0 +1,130 @@
+package client
+
+import (
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+type CircuitState int
+
+const (
+	CIRCUIT_CLOSED CircuitState = iota
+	CIRCUIT_HALF_OPEN
+	CIRCUIT_OPEN
+)
+
+func (state CircuitState) String() string {
+	switch state {
+	case CIRCUIT_CLOSED:
+		return "closed"
+	case CIRCUIT_HALF_OPEN:
+		return "half-open"
+	case CIRCUIT_OPEN:
+		return "open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker stops requests to an upstream after consecutive failures. While open, requests fail immediately.
+// After openDuration a single probe request is let through (half-open); its result closes or re-opens the circuit.
+type CircuitBreaker struct {
+	logger       *zap.SugaredLogger
+	threshold    int
+	openDuration time.Duration
+	onTransition func(state CircuitState)
+	// now returns the current time and is replaced in tests
+	now func() time.Time
+
+	lock     sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker creates a closed circuit breaker. onTransition is called on every state change and may be nil.
+func NewCircuitBreaker(threshold int, openDuration time.Duration, onTransition func(state CircuitState), logger *zap.SugaredLogger) *CircuitBreaker {
+	return &CircuitBreaker{
+		logger:       logger,
+		threshold:    threshold,
+		openDuration: openDuration,
+		onTransition: onTransition,
+		now:          time.Now,
+		state:        CIRCUIT_CLOSED,
+	}
+}
+
+func (breaker *CircuitBreaker) State() CircuitState {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	return breaker.state
+}
+
+// Allow reports whether a request may be sent. In half-open state only one probe request is allowed at a time.
+func (breaker *CircuitBreaker) Allow() bool {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	switch breaker.state {
+	case CIRCUIT_OPEN:
+		if breaker.now().Sub(breaker.openedAt) < breaker.openDuration {
+			return false
+		}
+		breaker.transition(CIRCUIT_HALF_OPEN)
+		breaker.probing = true
+		return true
+
+	case CIRCUIT_HALF_OPEN:
+		if breaker.probing {
+			return false
+		}
+		breaker.probing = true
+		return true
+	}
+
+	return true
+}
+
+func (breaker *CircuitBreaker) Success() {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	breaker.failures = 0
+	breaker.probing = false
+	if breaker.state != CIRCUIT_CLOSED {
+		breaker.transition(CIRCUIT_CLOSED)
+	}
+}
+
+func (breaker *CircuitBreaker) Failure() {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	breaker.failures++
+	breaker.probing = false
+
+	if breaker.state == CIRCUIT_HALF_OPEN || (breaker.state == CIRCUIT_CLOSED && breaker.failures >= breaker.threshold) {
+		breaker.openedAt = breaker.now()
+		breaker.transition(CIRCUIT_OPEN)
+	}
+}
+
+// Release gives up a permission returned by Allow without a result, e.g. if the request was cancelled
+func (breaker *CircuitBreaker) Release() {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	breaker.probing = false
+}
+
+// must be called with the lock held
+func (breaker *CircuitBreaker) transition(state CircuitState) {
+	breaker.logger.Warnw("circuit breaker changed state", "from", breaker.state.String(), "to", state.String(), "failures", breaker.failures)
+	breaker.state = state
+
+	if breaker.onTransition != nil {
+		breaker.onTransition(state)
+	}
+}
@@ -0,0 +1,207 @@
+package client
+
+import (
+	"go.uber.org/zap"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testClock is a manually advanced clock for the circuit breaker
+type testClock struct {
+	now time.Time
+}
+
+func (clock *testClock) Now() time.Time {
+	return clock.now
+}
+
+func (clock *testClock) Advance(duration time.Duration) {
+	clock.now = clock.now.Add(duration)
+}
+
+func newTestBreaker(threshold int, openDuration time.Duration) (*CircuitBreaker, *testClock, *[]CircuitState) {
+	clock := &testClock{now: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)}
+	transitions := &[]CircuitState{}
+
+	breaker := NewCircuitBreaker(threshold, openDuration, func(state CircuitState) {
+		*transitions = append(*transitions, state)
+	}, zap.NewNop().Sugar())
+	breaker.now = clock.Now
+
+	return breaker, clock, transitions
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name        string
+		run         func(breaker *CircuitBreaker, clock *testClock)
+		state       CircuitState
+		transitions []CircuitState
+	}{
+		{
+			name: "stays closed below threshold",
+			run: func(breaker *CircuitBreaker, clock *testClock) {
+				breaker.Failure()
+				breaker.Failure()
+			},
+			state:       CIRCUIT_CLOSED,
+			transitions: []CircuitState{},
+		},
+		{
+			name: "success resets failures",
+			run: func(breaker *CircuitBreaker, clock *testClock) {
+				breaker.Failure()
+				breaker.Failure()
+				breaker.Success()
+				breaker.Failure()
+				breaker.Failure()
+			},
+			state:       CIRCUIT_CLOSED,
+			transitions: []CircuitState{},
+		},
+		{
+			name: "opens at threshold",
+			run: func(breaker *CircuitBreaker, clock *testClock) {
+				breaker.Failure()
+				breaker.Failure()
+				breaker.Failure()
+			},
+			state:       CIRCUIT_OPEN,
+			transitions: []CircuitState{CIRCUIT_OPEN},
+		},
+		{
+			name: "stays open until open duration passed",
+			run: func(breaker *CircuitBreaker, clock *testClock) {
+				breaker.Failure()
+				breaker.Failure()
+				breaker.Failure()
+				clock.Advance(time.Minute - time.Nanosecond)
+				breaker.Allow()
+			},
+			state:       CIRCUIT_OPEN,
+			transitions: []CircuitState{CIRCUIT_OPEN},
+		},
+		{
+			name: "half-open after open duration",
+			run: func(breaker *CircuitBreaker, clock *testClock) {
+				breaker.Failure()
+				breaker.Failure()
+				breaker.Failure()
+				clock.Advance(time.Minute)
+				breaker.Allow()
+			},
+			state:       CIRCUIT_HALF_OPEN,
+			transitions: []CircuitState{CIRCUIT_OPEN, CIRCUIT_HALF_OPEN},
+		},
+		{
+			name: "successful probe closes",
+			run: func(breaker *CircuitBreaker, clock *testClock) {
+				breaker.Failure()
+				breaker.Failure()
+				breaker.Failure()
+				clock.Advance(time.Minute)
+				breaker.Allow()
+				breaker.Success()
+			},
+			state:       CIRCUIT_CLOSED,
+			transitions: []CircuitState{CIRCUIT_OPEN, CIRCUIT_HALF_OPEN, CIRCUIT_CLOSED},
+		},
+		{
+			name: "failed probe re-opens",
+			run: func(breaker *CircuitBreaker, clock *testClock) {
+				breaker.Failure()
+				breaker.Failure()
+				breaker.Failure()
+				clock.Advance(time.Minute)
+				breaker.Allow()
+				breaker.Failure()
+			},
+			state:       CIRCUIT_OPEN,
+			transitions: []CircuitState{CIRCUIT_OPEN, CIRCUIT_HALF_OPEN, CIRCUIT_OPEN},
+		},
+		{
+			name: "closed after recovery needs threshold failures again",
+			run: func(breaker *CircuitBreaker, clock *testClock) {
+				breaker.Failure()
+				breaker.Failure()
+				breaker.Failure()
+				clock.Advance(time.Minute)
+				breaker.Allow()
+				breaker.Success()
+				breaker.Failure()
+				breaker.Failure()
+			},
+			state:       CIRCUIT_CLOSED,
+			transitions: []CircuitState{CIRCUIT_OPEN, CIRCUIT_HALF_OPEN, CIRCUIT_CLOSED},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			breaker, clock, transitions := newTestBreaker(3, time.Minute)
+			test.run(breaker, clock)
+
+			if state := breaker.State(); state != test.state {
+				t.Errorf("expected %v, got %v", test.state, state)
+			}
+			if !reflect.DeepEqual(*transitions, test.transitions) {
+				t.Errorf("expected transitions %v, got %v", test.transitions, *transitions)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerOpenRejects(t *testing.T) {
+	breaker, clock, _ := newTestBreaker(1, time.Minute)
+
+	if !breaker.Allow() {
+		t.Fatal("closed circuit rejected request")
+	}
+	breaker.Failure()
+
+	for i := 0; i < 3; i++ {
+		if breaker.Allow() {
+			t.Fatal("open circuit allowed request")
+		}
+		clock.Advance(10 * time.Second)
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	breaker, clock, _ := newTestBreaker(1, time.Minute)
+	breaker.Failure()
+	clock.Advance(time.Minute)
+
+	if !breaker.Allow() {
+		t.Fatal("probe rejected after open duration")
+	}
+	// further requests are rejected while the probe is running
+	if breaker.Allow() {
+		t.Fatal("second probe allowed")
+	}
+
+	// a released probe lets the next request probe instead
+	breaker.Release()
+	if !breaker.Allow() {
+		t.Fatal("probe rejected after release")
+	}
+	if breaker.Allow() {
+		t.Fatal("second probe allowed after release")
+	}
+
+	// the failed probe re-opens the circuit for another open duration
+	breaker.Failure()
+	if breaker.Allow() {
+		t.Fatal("re-opened circuit allowed request")
+	}
+	clock.Advance(time.Minute)
+	if !breaker.Allow() {
+		t.Fatal("probe rejected after second open duration")
+	}
+	breaker.Success()
+
+	if !breaker.Allow() || !breaker.Allow() {
+		t.Error("closed circuit rejected requests")
+	}
+}
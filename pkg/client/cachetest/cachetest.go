@@ -0,0 +1,365 @@
+// Package cachetest provides a conformance suite which every client.CacheStore implementation must pass.
+//
+// Usage from a _test.go file of a backend:
+//
+//	func TestMyStore(t *testing.T) {
+//		cachetest.TestCacheStore(t, func(t *testing.T) client.CacheStore {
+//			return NewMyStore(...)
+//		})
+//	}
+package cachetest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/lukeelten/openshift-update-proxy/pkg/client"
+	"github.com/lukeelten/openshift-update-proxy/pkg/utils"
+	"sync"
+	"testing"
+	"time"
+)
+
+// StoreFactory must return a new, empty store with a default lifetime of one hour for every call.
+type StoreFactory func(t *testing.T) client.CacheStore
+
+// TestCacheStore runs the conformance suite against stores created by newStore.
+func TestCacheStore(t *testing.T, newStore StoreFactory) {
+	t.Run("GetMissing", func(t *testing.T) { testGetMissing(t, newStore(t)) })
+	t.Run("SetGet", func(t *testing.T) { testSetGet(t, newStore(t)) })
+	t.Run("Overwrite", func(t *testing.T) { testOverwrite(t, newStore(t)) })
+	t.Run("Validators", func(t *testing.T) { testValidators(t, newStore(t)) })
+	t.Run("Lifetime", func(t *testing.T) { testLifetime(t, newStore(t)) })
+	t.Run("ZeroLifetime", func(t *testing.T) { testZeroLifetime(t, newStore(t)) })
+	t.Run("DefaultLifetime", func(t *testing.T) { testDefaultLifetime(t, newStore(t)) })
+	t.Run("AccessTracking", func(t *testing.T) { testAccessTracking(t, newStore(t)) })
+	t.Run("SharedBodies", func(t *testing.T) { testSharedBodies(t, newStore(t)) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newStore(t)) })
+	t.Run("KeysAreDistinct", func(t *testing.T) { testKeysAreDistinct(t, newStore(t)) })
+	t.Run("Foreach", func(t *testing.T) { testForeach(t, newStore(t)) })
+	t.Run("ForeachModify", func(t *testing.T) { testForeachModify(t, newStore(t)) })
+	t.Run("Concurrent", func(t *testing.T) { testConcurrent(t, newStore(t)) })
+}
+
+func newEntry(arch, channel, version string, body []byte) client.VersionEntry {
+	return client.VersionEntry{
+		Arch:    arch,
+		Channel: channel,
+		Version: version,
+		Body:    body,
+	}
+}
+
+func testGetMissing(t *testing.T, store client.CacheStore) {
+	if store.HasKey("amd64", "stable-4.14", "4.14.1") {
+		t.Error("empty store reports key")
+	}
+
+	_, err := store.Get("amd64", "stable-4.14", "4.14.1")
+	if !errors.Is(err, utils.ERR_NOT_FOUND) {
+		t.Errorf("expected ERR_NOT_FOUND, got %v", err)
+	}
+
+	if store.Size() != 0 {
+		t.Errorf("expected size 0, got %v", store.Size())
+	}
+}
+
+func testSetGet(t *testing.T, store client.CacheStore) {
+	body := []byte(`{"nodes":[],"edges":[]}`)
+	store.Set(newEntry("amd64", "stable-4.14", "4.14.1", body), client.DEFAULT_LIFETIME)
+
+	if !store.HasKey("amd64", "stable-4.14", "4.14.1") {
+		t.Error("store does not report key after set")
+	}
+
+	got, err := store.Get("amd64", "stable-4.14", "4.14.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(got.Body, body) {
+		t.Errorf("expected body %q, got %q", body, got.Body)
+	}
+	if got.Arch != "amd64" || got.Channel != "stable-4.14" || got.Version != "4.14.1" {
+		t.Errorf("unexpected entry %+v", got)
+	}
+	if !got.ValidUntil.After(got.LastAccessed) {
+		t.Errorf("entry is not valid after being set: %+v", got)
+	}
+
+	if store.Size() != 1 {
+		t.Errorf("expected size 1, got %v", store.Size())
+	}
+	if store.Bytes() != float64(len(body)) {
+		t.Errorf("expected %d bytes, got %v", len(body), store.Bytes())
+	}
+}
+
+func testOverwrite(t *testing.T, store client.CacheStore) {
+	store.Set(newEntry("amd64", "stable-4.14", "4.14.1", []byte("old")), client.DEFAULT_LIFETIME)
+	store.Set(newEntry("amd64", "stable-4.14", "4.14.1", []byte("new")), client.DEFAULT_LIFETIME)
+
+	got, err := store.Get("amd64", "stable-4.14", "4.14.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got.Body) != "new" {
+		t.Errorf("expected body %q, got %q", "new", got.Body)
+	}
+
+	if store.Size() != 1 {
+		t.Errorf("expected size 1, got %v", store.Size())
+	}
+	if store.Bytes() != 3 {
+		t.Errorf("expected 3 bytes, got %v", store.Bytes())
+	}
+}
+
+func testValidators(t *testing.T, store client.CacheStore) {
+	entry := newEntry("amd64", "stable-4.14", "4.14.1", []byte("body"))
+	entry.ETag = `"abc"`
+	entry.LastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	store.Set(entry, client.DEFAULT_LIFETIME)
+
+	got, err := store.Get("amd64", "stable-4.14", "4.14.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.ETag != entry.ETag || got.LastModified != entry.LastModified {
+		t.Errorf("validators not stored: %+v", got)
+	}
+
+	store.Foreach(func(e client.VersionEntry) {
+		if e.ETag != entry.ETag || e.LastModified != entry.LastModified {
+			t.Errorf("validators not passed to foreach: %+v", e)
+		}
+	})
+}
+
+func testLifetime(t *testing.T, store client.CacheStore) {
+	before := time.Now()
+	store.Set(newEntry("amd64", "stable-4.14", "4.14.1", []byte("body")), time.Minute)
+
+	got, err := store.Get("amd64", "stable-4.14", "4.14.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.ValidUntil.Before(before.Add(time.Minute)) || got.ValidUntil.After(time.Now().Add(time.Minute)) {
+		t.Errorf("expected entry to be valid for one minute, got %v", got.ValidUntil.Sub(before))
+	}
+}
+
+func testZeroLifetime(t *testing.T, store client.CacheStore) {
+	store.Set(newEntry("amd64", "stable-4.14", "4.14.1", []byte("body")), 0)
+
+	got, err := store.Get("amd64", "stable-4.14", "4.14.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.ValidUntil.After(time.Now()) {
+		t.Errorf("expected entry with zero lifetime to be expired, valid until %v", got.ValidUntil)
+	}
+}
+
+func testDefaultLifetime(t *testing.T, store client.CacheStore) {
+	before := time.Now()
+	store.Set(newEntry("amd64", "stable-4.14", "4.14.1", []byte("body")), client.DEFAULT_LIFETIME)
+
+	got, err := store.Get("amd64", "stable-4.14", "4.14.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.ValidUntil.Before(before.Add(time.Hour)) || got.ValidUntil.After(time.Now().Add(time.Hour)) {
+		t.Errorf("expected entry to be valid for the default lifetime of one hour, got %v", got.ValidUntil.Sub(before))
+	}
+}
+
+func testAccessTracking(t *testing.T, store client.CacheStore) {
+	store.Set(newEntry("amd64", "stable-4.14", "4.14.1", []byte("body")), client.DEFAULT_LIFETIME)
+
+	initial, err := store.Peek("amd64", "stable-4.14", "4.14.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if initial.AccessCount != 0 {
+		t.Errorf("expected no accesses after set, got %d", initial.AccessCount)
+	}
+
+	time.Sleep(time.Millisecond)
+	store.Get("amd64", "stable-4.14", "4.14.1")
+	store.Get("amd64", "stable-4.14", "4.14.1")
+
+	accessed, _ := store.Peek("amd64", "stable-4.14", "4.14.1")
+	if accessed.AccessCount != 2 {
+		t.Errorf("expected 2 accesses, got %d", accessed.AccessCount)
+	}
+	if !accessed.LastAccessed.After(initial.LastAccessed) {
+		t.Errorf("access time not updated: %v -> %v", initial.LastAccessed, accessed.LastAccessed)
+	}
+
+	store.Foreach(func(entry client.VersionEntry) {
+		if entry.AccessCount != 2 || !entry.LastAccessed.Equal(accessed.LastAccessed) {
+			t.Errorf("access statistics not passed to foreach: %+v", entry)
+		}
+	})
+
+	// refreshing an entry is not an access
+	store.Set(newEntry("amd64", "stable-4.14", "4.14.1", []byte("new")), client.DEFAULT_LIFETIME)
+	refreshed, _ := store.Peek("amd64", "stable-4.14", "4.14.1")
+	if refreshed.AccessCount != 2 || !refreshed.LastAccessed.Equal(accessed.LastAccessed) {
+		t.Errorf("access statistics changed by set: %+v", refreshed)
+	}
+}
+
+func testSharedBodies(t *testing.T, store client.CacheStore) {
+	body := []byte("identical body")
+	store.Set(newEntry("amd64", "stable-4.14", "4.14.1", body), client.DEFAULT_LIFETIME)
+	store.Set(newEntry("amd64", "stable-4.14", "4.14.2", body), client.DEFAULT_LIFETIME)
+
+	if store.Bytes() != float64(len(body)) {
+		t.Errorf("expected identical bodies to be counted once (%d bytes), got %v", len(body), store.Bytes())
+	}
+
+	store.Delete("amd64", "stable-4.14", "4.14.1")
+	got, err := store.Get("amd64", "stable-4.14", "4.14.2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(got.Body, body) {
+		t.Errorf("shared body lost after deleting other entry: %q", got.Body)
+	}
+
+	store.Delete("amd64", "stable-4.14", "4.14.2")
+	if store.Bytes() != 0 {
+		t.Errorf("expected 0 bytes, got %v", store.Bytes())
+	}
+}
+
+func testDelete(t *testing.T, store client.CacheStore) {
+	store.Set(newEntry("amd64", "stable-4.14", "4.14.1", []byte("body")), client.DEFAULT_LIFETIME)
+	store.Delete("amd64", "stable-4.14", "4.14.1")
+
+	if store.HasKey("amd64", "stable-4.14", "4.14.1") {
+		t.Error("store reports key after delete")
+	}
+
+	_, err := store.Get("amd64", "stable-4.14", "4.14.1")
+	if !errors.Is(err, utils.ERR_NOT_FOUND) {
+		t.Errorf("expected ERR_NOT_FOUND, got %v", err)
+	}
+
+	// deleting a missing entry must not fail
+	store.Delete("amd64", "stable-4.14", "4.14.1")
+
+	if store.Size() != 0 {
+		t.Errorf("expected size 0, got %v", store.Size())
+	}
+	if store.Bytes() != 0 {
+		t.Errorf("expected 0 bytes, got %v", store.Bytes())
+	}
+}
+
+func testKeysAreDistinct(t *testing.T, store client.CacheStore) {
+	entries := []struct {
+		arch, channel, version, body string
+	}{
+		{"amd64", "stable-4.14", "4.14.1", "a"},
+		{"arm64", "stable-4.14", "4.14.1", "b"},
+		{"amd64", "fast-4.14", "4.14.1", "c"},
+		{"amd64", "stable-4.14", "4.14.2", "d"},
+	}
+
+	for _, e := range entries {
+		store.Set(newEntry(e.arch, e.channel, e.version, []byte(e.body)), client.DEFAULT_LIFETIME)
+	}
+
+	for _, e := range entries {
+		got, err := store.Get(e.arch, e.channel, e.version)
+		if err != nil {
+			t.Errorf("%s/%s/%s: unexpected error: %v", e.arch, e.channel, e.version, err)
+			continue
+		}
+		if string(got.Body) != e.body {
+			t.Errorf("%s/%s/%s: expected body %q, got %q", e.arch, e.channel, e.version, e.body, got.Body)
+		}
+	}
+
+	if store.Size() != float64(len(entries)) {
+		t.Errorf("expected size %d, got %v", len(entries), store.Size())
+	}
+}
+
+func testForeach(t *testing.T, store client.CacheStore) {
+	for i := 0; i < 5; i++ {
+		store.Set(newEntry("amd64", "stable-4.14", fmt.Sprintf("4.14.%d", i), []byte("body")), client.DEFAULT_LIFETIME)
+	}
+
+	seen := make(map[string]bool)
+	store.Foreach(func(entry client.VersionEntry) {
+		if entry.Arch != "amd64" || entry.Channel != "stable-4.14" {
+			t.Errorf("unexpected entry %+v", entry)
+		}
+		if entry.ValidUntil.IsZero() || entry.LastAccessed.IsZero() {
+			t.Errorf("entry %s has no timestamps", entry.Version)
+		}
+		if seen[entry.Version] {
+			t.Errorf("entry %s visited twice", entry.Version)
+		}
+		seen[entry.Version] = true
+	})
+
+	if len(seen) != 5 {
+		t.Errorf("expected 5 entries, visited %d", len(seen))
+	}
+}
+
+func testForeachModify(t *testing.T, store client.CacheStore) {
+	for i := 0; i < 5; i++ {
+		store.Set(newEntry("amd64", "stable-4.14", fmt.Sprintf("4.14.%d", i), []byte("body")), client.DEFAULT_LIFETIME)
+	}
+
+	store.Foreach(func(entry client.VersionEntry) {
+		store.Delete(entry.Arch, entry.Channel, entry.Version)
+		store.Set(newEntry(entry.Arch, "fast-4.14", entry.Version, []byte("moved")), client.DEFAULT_LIFETIME)
+	})
+
+	if store.Size() != 5 {
+		t.Errorf("expected size 5, got %v", store.Size())
+	}
+	if store.HasKey("amd64", "stable-4.14", "4.14.0") {
+		t.Error("deleted entry still present")
+	}
+	if !store.HasKey("amd64", "fast-4.14", "4.14.0") {
+		t.Error("added entry missing")
+	}
+}
+
+func testConcurrent(t *testing.T, store client.CacheStore) {
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			version := fmt.Sprintf("4.14.%d", i%3)
+			for j := 0; j < 50; j++ {
+				store.Set(newEntry("amd64", "stable-4.14", version, []byte(version)), client.DEFAULT_LIFETIME)
+				store.HasKey("amd64", "stable-4.14", version)
+				if entry, err := store.Get("amd64", "stable-4.14", version); err == nil && string(entry.Body) != version {
+					t.Errorf("got body %q for version %s", entry.Body, version)
+				}
+				store.Foreach(func(entry client.VersionEntry) {})
+				store.Size()
+				store.Bytes()
+				if j%10 == 0 {
+					store.Delete("amd64", "stable-4.14", version)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"github.com/lukeelten/openshift-update-proxy/pkg/utils"
+	"sync"
+	"time"
+)
+
+// channelState tracks whether the upstream returns the same graph for every version of a channel.
+// A channel is considered version-independent once two different versions returned identical bodies
+// in a row, and dependent again as soon as they differ.
+type channelState struct {
+	version            string
+	bodyHash           string
+	versionIndependent bool
+}
+
+type channelTracker struct {
+	lock     sync.Mutex
+	channels map[string]*channelState
+}
+
+func newChannelTracker() *channelTracker {
+	return &channelTracker{
+		channels: make(map[string]*channelState),
+	}
+}
+
+// record stores the hash of the body the upstream returned for a version
+func (tracker *channelTracker) record(arch, channel, version, bodyHash string) {
+	key := utils.MakeKey(arch, channel, "")
+
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	state, ok := tracker.channels[key]
+	if !ok {
+		tracker.channels[key] = &channelState{version: version, bodyHash: bodyHash}
+		return
+	}
+
+	if state.version != version {
+		state.versionIndependent = state.bodyHash == bodyHash
+	}
+	state.version = version
+	state.bodyHash = bodyHash
+}
+
+// source returns the version whose upstream response can be reused for the given version of a channel
+func (tracker *channelTracker) source(arch, channel, version string) (string, bool) {
+	key := utils.MakeKey(arch, channel, "")
+
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	state, ok := tracker.channels[key]
+	if !ok || !state.versionIndependent || state.version == version {
+		return "", false
+	}
+
+	return state.version, true
+}
+
+// loadShared stores a copy of a fresh entry of another version of the same channel if the upstream is known
+// to return the same graph for every version. Returns false if no such entry is available.
+func (client *OpenShiftVersionClient) loadShared(arch, channel, version string) bool {
+	if !client.config.Cache.ShareAcrossVersions {
+		return false
+	}
+
+	sourceVersion, ok := client.channels.source(arch, channel, version)
+	if !ok {
+		return false
+	}
+
+	source, err := client.cache.Peek(arch, channel, sourceVersion)
+	if err != nil || !time.Now().Before(source.ValidUntil) {
+		return false
+	}
+
+	client.logger.Debugw("reuse upstream response of other version", "arch", arch, "channel", channel, "version", version, "source", sourceVersion)
+	client.metrics.UpstreamShared.WithLabelValues(client.name, arch, channel, version).Inc()
+
+	client.cache.Set(VersionEntry{
+		Arch:         arch,
+		Channel:      channel,
+		Version:      version,
+		Body:         source.Body,
+		ETag:         source.ETag,
+		LastModified: source.LastModified,
+		Endpoint:     source.Endpoint,
+	}, time.Until(source.ValidUntil))
+	client.updateCacheMetrics()
+	return true
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"testing"
+)
+
+type recorded struct {
+	arch     string
+	version  string
+	bodyHash string
+}
+
+func TestChannelTracker(t *testing.T) {
+	tests := []struct {
+		name     string
+		recorded []recorded
+		arch     string
+		version  string
+		source   string
+		ok       bool
+	}{
+		{
+			name:    "unknown channel",
+			arch:    "amd64",
+			version: "4.14.1",
+		},
+		{
+			name:     "single version",
+			recorded: []recorded{{"amd64", "4.14.1", "a"}},
+			arch:     "amd64",
+			version:  "4.14.2",
+		},
+		{
+			name:     "identical graphs for different versions",
+			recorded: []recorded{{"amd64", "4.14.1", "a"}, {"amd64", "4.14.2", "a"}},
+			arch:     "amd64",
+			version:  "4.14.3",
+			source:   "4.14.2",
+			ok:       true,
+		},
+		{
+			name:     "different graphs for different versions",
+			recorded: []recorded{{"amd64", "4.14.1", "a"}, {"amd64", "4.14.2", "b"}},
+			arch:     "amd64",
+			version:  "4.14.3",
+		},
+		{
+			name:     "dependent again after a different graph",
+			recorded: []recorded{{"amd64", "4.14.1", "a"}, {"amd64", "4.14.2", "a"}, {"amd64", "4.14.3", "b"}},
+			arch:     "amd64",
+			version:  "4.14.4",
+		},
+		{
+			name:     "independent again after identical graphs",
+			recorded: []recorded{{"amd64", "4.14.1", "a"}, {"amd64", "4.14.2", "b"}, {"amd64", "4.14.3", "b"}},
+			arch:     "amd64",
+			version:  "4.14.1",
+			source:   "4.14.3",
+			ok:       true,
+		},
+		{
+			name:     "same version twice",
+			recorded: []recorded{{"amd64", "4.14.1", "a"}, {"amd64", "4.14.1", "a"}},
+			arch:     "amd64",
+			version:  "4.14.2",
+		},
+		{
+			name:     "requested version is the source",
+			recorded: []recorded{{"amd64", "4.14.1", "a"}, {"amd64", "4.14.2", "a"}},
+			arch:     "amd64",
+			version:  "4.14.2",
+		},
+		{
+			name:     "other architecture",
+			recorded: []recorded{{"amd64", "4.14.1", "a"}, {"amd64", "4.14.2", "a"}},
+			arch:     "arm64",
+			version:  "4.14.3",
+		},
+		{
+			name:     "architectures are tracked separately",
+			recorded: []recorded{{"amd64", "4.14.1", "a"}, {"arm64", "4.14.2", "a"}},
+			arch:     "amd64",
+			version:  "4.14.3",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := newChannelTracker()
+			for _, record := range test.recorded {
+				tracker.record(record.arch, "stable-4.14", record.version, record.bodyHash)
+			}
+
+			source, ok := tracker.source(test.arch, "stable-4.14", test.version)
+			if source != test.source || ok != test.ok {
+				t.Errorf("expected source %q (%v), got %q (%v)", test.source, test.ok, source, ok)
+			}
+		})
+	}
+}
+
+func TestLoadShared(t *testing.T) {
+	tests := []struct {
+		name     string
+		share    bool
+		requests int32
+	}{
+		{name: "disabled by default", share: false, requests: 3},
+		{name: "enabled", share: true, requests: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			upstream := &testUpstream{}
+			client := newTestClient(t, upstream)
+			client.config.Cache.ShareAcrossVersions = test.share
+
+			for _, version := range []string{"4.14.1", "4.14.2", "4.14.3"} {
+				entry, err := client.Load(testRequest(version))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if string(entry.Body) != testGraph || entry.Version != version {
+					t.Errorf("unexpected entry %+v", entry)
+				}
+			}
+
+			if requests := upstream.requests.Load(); requests != test.requests {
+				t.Errorf("expected %d upstream requests, got %d", test.requests, requests)
+			}
+		})
+	}
+}
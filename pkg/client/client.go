@@ -1,36 +1,106 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"github.com/lukeelten/openshift-update-proxy/pkg/config"
 	"github.com/lukeelten/openshift-update-proxy/pkg/metrics"
 	"github.com/lukeelten/openshift-update-proxy/pkg/utils"
 	"go.uber.org/zap"
+	"math/rand"
 	"net/http"
+	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type OpenShiftVersionClient struct {
+	name     string
 	logger   *zap.SugaredLogger
 	config   *config.UpdateProxyConfig
-	cache    *OpenShiftVersionCache
+	cache    CacheStore
 	upstream *UpstreamClient
 
 	metrics *metrics.UpdateProxyMetrics
+
+	// set while the last request to the upstream failed
+	upstreamFailing atomic.Bool
+
+	// lifetime of the client, cancels all upstream requests on shutdown
+	ctx context.Context
+
+	// de-duplicates concurrent refreshes of the same entry
+	inflightLock sync.Mutex
+	inflight     map[string]*inflightLoad
+
+	channels *channelTracker
 }
 
-func NewOpenShiftVersionClient(cfg *config.UpdateProxyConfig, m *metrics.UpdateProxyMetrics, logger *zap.SugaredLogger, endpoint string, insecure bool, timeout time.Duration) *OpenShiftVersionClient {
-	return &OpenShiftVersionClient{
+func NewOpenShiftVersionClient(ctx context.Context, cfg *config.UpdateProxyConfig, m *metrics.UpdateProxyMetrics, logger *zap.SugaredLogger, upstream config.UpstreamConfig) (*OpenShiftVersionClient, error) {
+	logger = logger.With("upstream", upstream.Name)
+
+	upstreamClient, err := NewUpstreamClient(logger, m, upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &OpenShiftVersionClient{
+		name:     upstream.Name,
 		logger:   logger,
 		config:   cfg,
 		metrics:  m,
-		cache:    NewOpenShiftVersionCache(cfg.Cache.DefaultLifetime, logger),
-		upstream: NewUpstreamClient(logger, m, endpoint, insecure, timeout),
+		upstream: upstreamClient,
+		ctx:      ctx,
+		inflight: make(map[string]*inflightLoad),
+		channels: newChannelTracker(),
+	}
+
+	cache, err := NewCacheStore(cfg, upstream.Name, client.onEvict, logger)
+	if err != nil {
+		return nil, err
 	}
+
+	client.cache = cache
+	client.updateCacheMetrics()
+	return client, nil
+}
+
+func (client *OpenShiftVersionClient) Name() string {
+	return client.name
+}
+
+func (client *OpenShiftVersionClient) CircuitState() CircuitState {
+	return client.upstream.Breaker.State()
+}
+
+// Entries returns all cache entries without body, ordered by arch, channel and version
+func (client *OpenShiftVersionClient) Entries() []VersionEntry {
+	entries := make([]VersionEntry, 0, int(client.cache.Size()))
+	client.cache.Foreach(func(entry VersionEntry) {
+		entries = append(entries, entry)
+	})
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Arch != entries[j].Arch {
+			return entries[i].Arch < entries[j].Arch
+		}
+		if entries[i].Channel != entries[j].Channel {
+			return entries[i].Channel < entries[j].Channel
+		}
+		return entries[i].Version < entries[j].Version
+	})
+	return entries
 }
 
 func (client *OpenShiftVersionClient) CollectGarbage() {
+	if client.upstreamFailing.Load() {
+		// Evicted entries cannot be reloaded while the upstream is unreachable, so keep everything
+		client.logger.Infow("upstream is failing, skip garbage collection")
+		return
+	}
+
 	now := time.Now()
 	num := 0
 
@@ -38,6 +108,7 @@ func (client *OpenShiftVersionClient) CollectGarbage() {
 		if now.After(entry.LastAccessed.Add(client.config.Cache.EvictAfter)) {
 			client.logger.Debugw("Delete entry from cache", "entry", entry)
 			client.cache.Delete(entry.Arch, entry.Channel, entry.Version)
+			client.metrics.CacheEvictions.WithLabelValues(client.name, EVICTION_REASON_IDLE).Inc()
 			num++
 		}
 	})
@@ -46,64 +117,207 @@ func (client *OpenShiftVersionClient) CollectGarbage() {
 		client.logger.Infow("Deleted entries from cache", "entries", num)
 	}
 
-	client.metrics.CacheSize.WithLabelValues(client.upstream.Endpoint).Set(client.cache.Size())
+	client.updateCacheMetrics()
 }
 
-func (client *OpenShiftVersionClient) RefreshEntries() {
-	now := time.Now()
-	client.cache.Foreach(func(entry VersionEntry) {
-		if now.After(entry.ValidUntil) {
-			client.logger.Debugw("start refresh entry", "entry", entry)
-
-			if client.loadFromUpstream(entry.Arch, entry.Channel, entry.Version) {
-				client.metrics.RefreshCounter.WithLabelValues(entry.Arch, entry.Channel, entry.Version).Inc()
-			} else {
-				client.metrics.RefreshErrors.WithLabelValues(entry.Arch, entry.Channel, entry.Version).Inc()
-				client.logger.Errorw("got error refreshing entry", "arch", entry.Arch, "channel", entry.Channel, "version", entry.Version)
-			}
-		}
-	})
-	client.metrics.CacheSize.WithLabelValues(client.upstream.Endpoint).Set(client.cache.Size())
+// Flush writes the access statistics of the cache to persistent storage, if the cache store has one
+func (client *OpenShiftVersionClient) Flush() {
+	client.cache.Flush()
 }
 
-func (client *OpenShiftVersionClient) Load(request *http.Request) ([]byte, error) {
-	client.logger.Debugw("got request", "request", request)
+// Load returns the cache entry for the request. Expired entries are returned as long as they are within
+// the StaleIfError grace period. The caller can detect stale entries by checking StaleReason.
+// Upstream requests are cancelled when the context of the request is done and no other request waits for them.
+func (client *OpenShiftVersionClient) Load(request *http.Request) (VersionEntry, error) {
+	ctx := request.Context()
+	client.logger.Debugw("got request", "url", request.URL.String(), "remote", request.RemoteAddr)
 
 	arch, channel, version := utils.ExtractQueryParams(request)
 	if len(arch) == 0 || len(channel) == 0 || len(version) == 0 {
 		client.logger.Errorw("cannot extract version information")
-		return []byte{}, errors.New("no channel information present. Invalid request")
+		return VersionEntry{}, errors.New("no channel information present. Invalid request")
 	}
 
-	client.metrics.VersionAccessed.WithLabelValues(arch, channel, version).Inc()
+	client.metrics.VersionAccessed.WithLabelValues(client.name, arch, channel, version).Inc()
 	client.logger.Infow("got request for versions", "arch", arch, "channel", channel, "version", version)
 
-	if !client.cache.HasKey(arch, channel, version) {
-		client.metrics.MetricCacheMiss.WithLabelValues(arch, channel, version).Inc()
-		if !client.loadFromUpstream(arch, channel, version) {
-			client.logger.Errorw("cannot load version info from upstream")
-			client.logger.Debugw("error on request", "request", request)
-			return []byte{}, errors.New("no version info found")
+	entry, err := client.cache.Get(arch, channel, version)
+	if err != nil {
+		client.metrics.MetricCacheMiss.WithLabelValues(client.name, arch, channel, version).Inc()
+		return client.loadEntry(ctx, arch, channel, version)
+	}
+
+	client.metrics.MetricCacheHit.WithLabelValues(client.name, arch, channel, version).Inc()
+
+	now := time.Now()
+	if now.After(entry.ValidUntil) {
+		if now.After(entry.ValidUntil.Add(client.config.Cache.StaleIfError)) {
+			client.logger.Infow("cache entry exceeded stale grace period", "arch", arch, "channel", channel, "version", version, "validUntil", entry.ValidUntil)
+			return client.loadEntry(ctx, arch, channel, version)
+		}
+
+		// an expired entry of a healthy upstream is only served until the refresh completes
+		entry.StaleReason = STALE_REASON_REVALIDATE
+		if client.upstreamFailing.Load() {
+			entry.StaleReason = STALE_REASON_ERROR
+			client.logger.Warnw("serving stale cache entry", "arch", arch, "channel", channel, "version", version, "validUntil", entry.ValidUntil)
+		} else {
+			client.logger.Debugw("serving expired cache entry while refreshing", "arch", arch, "channel", channel, "version", version, "validUntil", entry.ValidUntil)
 		}
-	} else {
-		client.metrics.MetricCacheHit.WithLabelValues(arch, channel, version).Inc()
+		client.metrics.StaleResponses.WithLabelValues(client.name, arch, channel, version, entry.StaleReason).Inc()
+		client.refreshAsync(arch, channel, version)
+	}
+
+	return entry, nil
+}
+
+func (client *OpenShiftVersionClient) loadEntry(ctx context.Context, arch, channel, version string) (VersionEntry, error) {
+	loaded, err := client.coalesce(ctx, arch, channel, version, func(ctx context.Context) bool {
+		return client.loadFromUpstream(ctx, arch, channel, version) == nil
+	})
+
+	if err != nil {
+		client.logger.Infow("request cancelled while loading version info", "arch", arch, "channel", channel, "version", version, "err", err)
+		return VersionEntry{}, err
+	}
+
+	if !loaded {
+		client.logger.Errorw("cannot load version info from upstream", "arch", arch, "channel", channel, "version", version)
+		return VersionEntry{}, errors.New("no version info found")
 	}
 
 	return client.cache.Get(arch, channel, version)
 }
 
-func (client *OpenShiftVersionClient) loadFromUpstream(arch, channel, version string) bool {
+// refresh reloads an entry from upstream. Concurrent refreshes of the same entry share one upstream request.
+func (client *OpenShiftVersionClient) refresh(ctx context.Context, arch, channel, version string) bool {
+	loaded, _ := client.coalesce(ctx, arch, channel, version, func(ctx context.Context) bool {
+		return client.refreshEntry(ctx, arch, channel, version)
+	})
+	return loaded
+}
+
+// refreshAsync starts a refresh in the background unless one is already running for the entry.
+// The refresh is bound to the lifetime of the client instead of the request which triggered it.
+func (client *OpenShiftVersionClient) refreshAsync(arch, channel, version string) {
+	go client.refresh(client.ctx, arch, channel, version)
+}
+
+func (client *OpenShiftVersionClient) refreshEntry(ctx context.Context, arch, channel, version string) bool {
+	err := client.loadFromUpstream(ctx, arch, channel, version)
+	if err == nil {
+		return true
+	}
+
+	if ctx.Err() != nil || errors.Is(err, utils.ERR_CIRCUIT_OPEN) {
+		return false
+	}
+
+	// The expired entry is kept and served as stale until StaleIfError has passed
+	client.metrics.RefreshErrors.WithLabelValues(client.name, arch, channel, version).Inc()
+	client.logger.Errorw("got error refreshing entry, keep stale entry", "arch", arch, "channel", channel, "version", version)
+	return false
+}
+
+// loadFromUpstream loads an entry from upstream and stores it in the cache. Existing entries are revalidated
+// with a conditional request, so the body is only transferred if it has changed. If the upstream returns the same
+// graph for every version of the channel, a fresh response for another version is reused instead.
+// While the circuit breaker is open, utils.ERR_CIRCUIT_OPEN is returned without counting it as an error.
+func (client *OpenShiftVersionClient) loadFromUpstream(ctx context.Context, arch, channel, version string) error {
+	if client.loadShared(arch, channel, version) {
+		return nil
+	}
+
 	client.logger.Infow("loading info from upstream", "arch", arch, "channel", channel, "version", version)
-	versionBody, err := client.upstream.LoadVersionInfo(arch, channel, version)
+
+	cached, cacheErr := client.cache.Peek(arch, channel, version)
+	response, err := client.upstream.LoadVersionInfo(ctx, arch, channel, version, cached.ETag, cached.LastModified)
+
+	if err != nil && ctx.Err() != nil {
+		client.logger.Debugw("upstream request cancelled", "arch", arch, "channel", channel, "version", version, "err", err)
+		return err
+	}
+
+	if errors.Is(err, utils.ERR_CIRCUIT_OPEN) {
+		// expected fast failure, the failing upstream has already been reported when the breaker opened
+		client.logger.Debugw("upstream unavailable, circuit breaker open", "arch", arch, "channel", channel, "version", version)
+		return err
+	}
 
 	if err != nil {
-		client.logger.Debugw("got error when loading upstream", "error", err, "arch", arch, "channel", channel, "version", version, "endpoint", client.upstream.Endpoint)
+		client.logger.Debugw("got error when loading upstream", "error", err, "arch", arch, "channel", channel, "version", version)
 		client.logger.Errorw("error loading from upstream", "err", err)
 		client.metrics.ErrorResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
-		return false
+		client.upstreamFailing.Store(true)
+		return err
 	}
 
-	client.cache.Set(arch, channel, version, versionBody)
-	client.metrics.CacheSize.WithLabelValues(client.upstream.Endpoint).Set(client.cache.Size())
-	return true
+	client.upstreamFailing.Store(false)
+
+	entry := VersionEntry{
+		Arch:         arch,
+		Channel:      channel,
+		Version:      version,
+		Body:         response.Body,
+		ETag:         response.ETag,
+		LastModified: response.LastModified,
+		Endpoint:     response.Endpoint,
+	}
+
+	if response.NotModified {
+		if cacheErr != nil {
+			client.logger.Errorw("upstream returned not modified for an entry which is not cached", "arch", arch, "channel", channel, "version", version)
+			return errors.New("upstream returned not modified for an entry which is not cached")
+		}
+
+		client.logger.Debugw("upstream entry not modified", "arch", arch, "channel", channel, "version", version)
+		client.metrics.RevalidationCounter.WithLabelValues(client.name, arch, channel, version).Inc()
+		entry.Body = cached.Body
+	} else if cacheErr == nil {
+		client.metrics.RefreshCounter.WithLabelValues(client.name, arch, channel, version).Inc()
+	}
+
+	client.logger.Infow("loaded info from upstream", "arch", arch, "channel", channel, "version", version, "endpoint", response.Endpoint, "notModified", response.NotModified)
+	client.channels.record(arch, channel, version, utils.ContentHash(entry.Body))
+	client.cache.Set(entry, client.lifetime(response))
+	client.updateCacheMetrics()
+	return nil
+}
+
+// lifetime returns the lifetime announced by the upstream clamped to the configured bounds, or the default
+// lifetime if the upstream did not announce one. The lifetime is shortened by a random jitter before it is clamped,
+// so entries loaded together are refreshed in different cycles without leaving the bounds.
+// An announced lifetime of 0 (max-age=0, no-cache) is kept and expires the entry immediately, unless MinLifetime is set.
+func (client *OpenShiftVersionClient) lifetime(response *UpstreamResponse) time.Duration {
+	lifetime := client.config.Cache.DefaultLifetime
+	if response.HasLifetime {
+		lifetime = response.Lifetime
+	}
+
+	jitter := client.config.Cache.LifetimeJitter
+	if jitter > 0 && jitter < 1 {
+		lifetime -= time.Duration(rand.Float64() * jitter * float64(lifetime))
+	}
+
+	// the bounds are applied after the jitter, so they hold for the stored lifetime
+	if response.HasLifetime {
+		if lifetime < client.config.Cache.MinLifetime {
+			lifetime = client.config.Cache.MinLifetime
+		}
+		if client.config.Cache.MaxLifetime > 0 && lifetime > client.config.Cache.MaxLifetime {
+			lifetime = client.config.Cache.MaxLifetime
+		}
+	}
+
+	return lifetime
+}
+
+func (client *OpenShiftVersionClient) onEvict(entry VersionEntry, reason string) {
+	client.logger.Infow("evicted entry from cache", "arch", entry.Arch, "channel", entry.Channel, "version", entry.Version, "reason", reason)
+	client.metrics.CacheEvictions.WithLabelValues(client.name, reason).Inc()
+}
+
+func (client *OpenShiftVersionClient) updateCacheMetrics() {
+	client.metrics.CacheSize.WithLabelValues(client.name).Set(client.cache.Size())
+	client.metrics.CacheBytes.WithLabelValues(client.name).Set(client.cache.Bytes())
 }
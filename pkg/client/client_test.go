@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"github.com/lukeelten/openshift-update-proxy/pkg/config"
+	"github.com/lukeelten/openshift-update-proxy/pkg/metrics"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testGraph = `{"nodes":[{"version":"4.14.1","payload":"a"},{"version":"4.14.2","payload":"b"}],"edges":[[0,1]]}`
+
+var (
+	testMetricsOnce sync.Once
+	testMetrics     *metrics.UpdateProxyMetrics
+)
+
+// newTestMetrics returns the metrics shared by all tests, as metrics can only be registered once
+func newTestMetrics() *metrics.UpdateProxyMetrics {
+	testMetricsOnce.Do(func() {
+		testMetrics = metrics.NewUpdateProxyMetrics(&config.UpdateProxyConfig{})
+	})
+	return testMetrics
+}
+
+// testUpstream serves testGraph until failing is set
+type testUpstream struct {
+	failing  atomic.Bool
+	requests atomic.Int32
+}
+
+func (upstream *testUpstream) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	upstream.requests.Add(1)
+	if upstream.failing.Load() {
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writer.Write([]byte(testGraph))
+}
+
+func newTestClient(t *testing.T, handler http.Handler) *OpenShiftVersionClient {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg := &config.UpdateProxyConfig{}
+	cfg.Cache.DefaultLifetime = time.Hour
+	cfg.Cache.StaleIfError = time.Hour
+
+	upstream := config.UpstreamConfig{
+		Name:      "test",
+		Endpoints: []string{server.URL},
+		Timeout:   time.Second,
+		Retry: config.RetryConfig{
+			MaxAttempts:    1,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     time.Millisecond,
+			Deadline:       time.Second,
+		},
+		CircuitBreaker: config.CircuitBreakerConfig{FailureThreshold: 100, OpenDuration: time.Minute},
+	}
+
+	client, err := NewOpenShiftVersionClient(context.Background(), cfg, newTestMetrics(), zap.NewNop().Sugar(), upstream)
+	if err != nil {
+		t.Fatalf("cannot create client: %v", err)
+	}
+	return client
+}
+
+func testRequest(version string) *http.Request {
+	return httptest.NewRequest(http.MethodGet, "/test?arch=amd64&channel=stable-4.14&version="+version, nil)
+}
+
+// expire makes the cached entry stale without changing its body
+func expire(t *testing.T, client *OpenShiftVersionClient, version string) {
+	t.Helper()
+
+	entry, err := client.cache.Peek("amd64", "stable-4.14", version)
+	if err != nil {
+		t.Fatalf("entry not cached: %v", err)
+	}
+	client.cache.Set(entry, 0)
+}
+
+func TestLoadStaleReason(t *testing.T) {
+	upstream := &testUpstream{}
+	client := newTestClient(t, upstream)
+
+	entry, err := client.Load(testRequest("4.14.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.StaleReason != "" {
+		t.Errorf("fresh entry marked stale: %s", entry.StaleReason)
+	}
+
+	// an expired entry of a healthy upstream is served while it is refreshed
+	expire(t, client, "4.14.1")
+	entry, err = client.Load(testRequest("4.14.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.StaleReason != STALE_REASON_REVALIDATE {
+		t.Errorf("expected stale reason %s, got %q", STALE_REASON_REVALIDATE, entry.StaleReason)
+	}
+
+	// wait for the background refresh, so it does not race with the failing upstream below
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if refreshed, _ := client.cache.Peek("amd64", "stable-4.14", "4.14.1"); time.Now().Before(refreshed.ValidUntil) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// an expired entry of a failing upstream is served as stale
+	upstream.failing.Store(true)
+	expire(t, client, "4.14.1")
+	if client.refresh(context.Background(), "amd64", "stable-4.14", "4.14.1") {
+		t.Fatal("refresh succeeded for failing upstream")
+	}
+
+	entry, err = client.Load(testRequest("4.14.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.StaleReason != STALE_REASON_ERROR {
+		t.Errorf("expected stale reason %s, got %q", STALE_REASON_ERROR, entry.StaleReason)
+	}
+}
+
+func TestLifetime(t *testing.T) {
+	tests := []struct {
+		name     string
+		response UpstreamResponse
+		lifetime time.Duration
+	}{
+		{name: "default lifetime", response: UpstreamResponse{}, lifetime: 8 * time.Hour},
+		{name: "announced lifetime", response: UpstreamResponse{Lifetime: time.Hour, HasLifetime: true}, lifetime: time.Hour},
+		{name: "below minimum", response: UpstreamResponse{Lifetime: time.Minute, HasLifetime: true}, lifetime: 5 * time.Minute},
+		{name: "zero lifetime", response: UpstreamResponse{Lifetime: 0, HasLifetime: true}, lifetime: 5 * time.Minute},
+		{name: "above maximum", response: UpstreamResponse{Lifetime: 48 * time.Hour, HasLifetime: true}, lifetime: 24 * time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.UpdateProxyConfig{}
+			cfg.Cache.DefaultLifetime = 8 * time.Hour
+			cfg.Cache.MinLifetime = 5 * time.Minute
+			cfg.Cache.MaxLifetime = 24 * time.Hour
+			client := &OpenShiftVersionClient{config: cfg}
+
+			if lifetime := client.lifetime(&test.response); lifetime != test.lifetime {
+				t.Errorf("expected %v, got %v", test.lifetime, lifetime)
+			}
+		})
+	}
+}
+
+func TestLifetimeWithoutBounds(t *testing.T) {
+	client := &OpenShiftVersionClient{config: &config.UpdateProxyConfig{}}
+
+	// a zero lifetime expires the entry immediately and is never taken for DEFAULT_LIFETIME
+	if lifetime := client.lifetime(&UpstreamResponse{Lifetime: 0, HasLifetime: true}); lifetime != 0 {
+		t.Errorf("expected 0, got %v", lifetime)
+	}
+	if lifetime := client.lifetime(&UpstreamResponse{Lifetime: 48 * time.Hour, HasLifetime: true}); lifetime != 48*time.Hour {
+		t.Errorf("expected unbounded lifetime, got %v", lifetime)
+	}
+}
+
+func TestLifetimeJitter(t *testing.T) {
+	cfg := &config.UpdateProxyConfig{}
+	cfg.Cache.DefaultLifetime = 8 * time.Hour
+	cfg.Cache.MinLifetime = 5 * time.Minute
+	cfg.Cache.MaxLifetime = 24 * time.Hour
+	cfg.Cache.LifetimeJitter = 0.5
+	client := &OpenShiftVersionClient{config: cfg}
+
+	tests := []struct {
+		name     string
+		response UpstreamResponse
+		min      time.Duration
+		max      time.Duration
+	}{
+		{name: "default lifetime", response: UpstreamResponse{}, min: 4 * time.Hour, max: 8 * time.Hour},
+		{name: "announced lifetime", response: UpstreamResponse{Lifetime: time.Hour, HasLifetime: true}, min: 30 * time.Minute, max: time.Hour},
+		// the jitter must not shorten the lifetime below the minimum
+		{name: "minimum", response: UpstreamResponse{Lifetime: 6 * time.Minute, HasLifetime: true}, min: 5 * time.Minute, max: 6 * time.Minute},
+		{name: "maximum", response: UpstreamResponse{Lifetime: 48 * time.Hour, HasLifetime: true}, min: 24 * time.Hour, max: 24 * time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			varies := false
+			first := client.lifetime(&test.response)
+			for i := 0; i < 100; i++ {
+				lifetime := client.lifetime(&test.response)
+				if lifetime < test.min || lifetime > test.max {
+					t.Fatalf("expected lifetime between %v and %v, got %v", test.min, test.max, lifetime)
+				}
+				varies = varies || lifetime != first
+			}
+			if !varies && test.min != test.max {
+				t.Error("jitter not applied")
+			}
+		})
+	}
+}
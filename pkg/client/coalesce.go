@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"github.com/lukeelten/openshift-update-proxy/pkg/utils"
+)
+
+// inflightLoad is an upstream request shared by all callers asking for the same entry. The request runs with
+// its own context, which is cancelled once every caller waiting for it has gone away.
+type inflightLoad struct {
+	done   chan struct{}
+	result bool
+
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// coalesce runs loadFunc unless a request for the same entry is already in flight. In that case
+// it waits for the running request and shares its result. If ctx is done before the request finished,
+// ctx.Err() is returned.
+func (client *OpenShiftVersionClient) coalesce(ctx context.Context, arch, channel, version string, loadFunc func(ctx context.Context) bool) (bool, error) {
+	key := utils.MakeKey(arch, channel, version)
+
+	client.inflightLock.Lock()
+	load, ok := client.inflight[key]
+	if ok {
+		client.logger.Debugw("coalesced upstream request", "arch", arch, "channel", channel, "version", version)
+		client.metrics.UpstreamCoalesced.WithLabelValues(client.name, arch, channel, version).Inc()
+	} else {
+		load = client.startLoad(key, loadFunc)
+	}
+	load.waiters++
+	client.inflightLock.Unlock()
+
+	select {
+	case <-load.done:
+		return load.result, nil
+
+	case <-ctx.Done():
+		client.inflightLock.Lock()
+		load.waiters--
+		if load.waiters == 0 {
+			client.logger.Debugw("all callers gone, cancel upstream request", "arch", arch, "channel", channel, "version", version)
+			load.cancel()
+			client.forget(key, load)
+		}
+		client.inflightLock.Unlock()
+		return false, ctx.Err()
+	}
+}
+
+// startLoad must be called with the inflight lock held
+func (client *OpenShiftVersionClient) startLoad(key string, loadFunc func(ctx context.Context) bool) *inflightLoad {
+	ctx, cancel := context.WithCancel(client.ctx)
+	load := &inflightLoad{
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	client.inflight[key] = load
+
+	go func() {
+		defer close(load.done)
+		defer cancel()
+
+		load.result = loadFunc(ctx)
+
+		client.inflightLock.Lock()
+		client.forget(key, load)
+		client.inflightLock.Unlock()
+	}()
+
+	return load
+}
+
+// forget must be called with the inflight lock held
+func (client *OpenShiftVersionClient) forget(key string, load *inflightLoad) {
+	if client.inflight[key] == load {
+		delete(client.inflight, key)
+	}
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// UpstreamEndpoint is one endpoint of an upstream. Endpoints are tried in the configured order;
+// an endpoint which failed is skipped until its cooldown has passed.
+type UpstreamEndpoint struct {
+	URL string
+
+	// unix nanos until the endpoint is skipped, 0 if healthy
+	failedUntil atomic.Int64
+}
+
+func NewUpstreamEndpoint(url string) *UpstreamEndpoint {
+	return &UpstreamEndpoint{URL: url}
+}
+
+func (endpoint *UpstreamEndpoint) Healthy() bool {
+	return time.Now().UnixNano() >= endpoint.failedUntil.Load()
+}
+
+func (endpoint *UpstreamEndpoint) markFailed(cooldown time.Duration) {
+	endpoint.failedUntil.Store(time.Now().Add(cooldown).UnixNano())
+}
+
+func (endpoint *UpstreamEndpoint) markHealthy() {
+	endpoint.failedUntil.Store(0)
+}
+
+// orderedEndpoints returns the healthy endpoints in priority order followed by the endpoints in cooldown,
+// so a request is still attempted if all endpoints are failing.
+func (client *UpstreamClient) orderedEndpoints() []*UpstreamEndpoint {
+	healthy := make([]*UpstreamEndpoint, 0, len(client.Endpoints))
+	failing := make([]*UpstreamEndpoint, 0)
+
+	for _, endpoint := range client.Endpoints {
+		if endpoint.Healthy() {
+			healthy = append(healthy, endpoint)
+		} else {
+			failing = append(failing, endpoint)
+		}
+	}
+
+	return append(healthy, failing...)
+}
+
+func (client *UpstreamClient) endpointFailed(endpoint *UpstreamEndpoint, err error) {
+	client.Logger.Warnw("upstream endpoint failed", "endpoint", endpoint.URL, "err", err, "cooldown", client.FailoverCooldown)
+	endpoint.markFailed(client.FailoverCooldown)
+	client.Metrics.UpstreamEndpointRequests.WithLabelValues(client.Name, endpoint.URL, "error").Inc()
+	client.Metrics.UpstreamEndpointHealthy.WithLabelValues(client.Name, endpoint.URL).Set(0)
+}
+
+func (client *UpstreamClient) endpointSucceeded(endpoint *UpstreamEndpoint) {
+	if !endpoint.Healthy() {
+		client.Logger.Infow("upstream endpoint recovered", "endpoint", endpoint.URL)
+	}
+	endpoint.markHealthy()
+	client.Metrics.UpstreamEndpointRequests.WithLabelValues(client.Name, endpoint.URL, "success").Inc()
+	client.Metrics.UpstreamEndpointHealthy.WithLabelValues(client.Name, endpoint.URL).Set(1)
+}
@@ -0,0 +1,225 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/lukeelten/openshift-update-proxy/pkg/utils"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	persistedEntrySuffix = ".json"
+	temporaryFileSuffix  = ".tmp"
+	blobDirectory        = "blobs"
+)
+
+// FileVersionCache is a CacheStore which keeps all entries in memory and additionally writes them to a
+// directory, so they can be restored after a restart. Access statistics are written together with the entry
+// and by Flush, so after a restart they reflect the state of the last refresh or flush, whichever came later.
+//
+// Entries are written as JSON files named by their key, bodies are written once per content hash to the
+// blobs subdirectory.
+type FileVersionCache struct {
+	*OpenShiftVersionCache
+
+	directory string
+
+	// serializes writes, so the order of entries on disk matches the order in memory
+	writeLock sync.Mutex
+	// access count of each entry as written to disk, guarded by writeLock
+	persisted map[string]uint64
+}
+
+var _ CacheStore = &FileVersionCache{}
+
+func NewFileVersionCache(defaultLifetime time.Duration, maxEntries int, maxBytes int64, onEvict EvictionFunc, directory string, logger *zap.SugaredLogger) (*FileVersionCache, error) {
+	err := os.MkdirAll(filepath.Join(directory, blobDirectory), 0o750)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &FileVersionCache{
+		directory: directory,
+		persisted: make(map[string]uint64),
+	}
+
+	// evictions only happen while an entry is stored, so writeLock is held
+	cache.OpenShiftVersionCache = NewOpenShiftVersionCache(defaultLifetime, maxEntries, maxBytes, func(entry VersionEntry, reason string) {
+		key := utils.MakeKey(entry.Arch, entry.Channel, entry.Version)
+		delete(cache.persisted, key)
+		cache.removeFile(cache.entryFile(key))
+		if onEvict != nil {
+			onEvict(entry, reason)
+		}
+	}, logger)
+	cache.onBlobRemoved = func(hash string) {
+		cache.removeFile(cache.blobFile(hash))
+	}
+
+	err = cache.restore()
+	if err != nil {
+		return nil, err
+	}
+
+	return cache, nil
+}
+
+func (cache *FileVersionCache) Set(entry VersionEntry, lifetime time.Duration) {
+	entry = cache.newEntry(entry, lifetime)
+	key := utils.MakeKey(entry.Arch, entry.Channel, entry.Version)
+
+	cache.writeLock.Lock()
+	defer cache.writeLock.Unlock()
+
+	cache.persist(key, cache.put(entry))
+}
+
+func (cache *FileVersionCache) Delete(arch, channel, version string) {
+	key := utils.MakeKey(arch, channel, version)
+
+	cache.writeLock.Lock()
+	defer cache.writeLock.Unlock()
+
+	cache.OpenShiftVersionCache.Delete(arch, channel, version)
+	delete(cache.persisted, key)
+	cache.removeFile(cache.entryFile(key))
+}
+
+// Flush writes the access statistics of all entries which were accessed since they were last written
+func (cache *FileVersionCache) Flush() {
+	cache.writeLock.Lock()
+	defer cache.writeLock.Unlock()
+
+	num := 0
+	for key, entry := range cache.lightCopy() {
+		if accessCount, ok := cache.persisted[key]; ok && accessCount == entry.AccessCount {
+			continue
+		}
+
+		cache.writeEntry(key, entry)
+		num++
+	}
+
+	if num > 0 {
+		cache.Logger.Debugw("flushed access statistics to disk", "directory", cache.directory, "entries", num)
+	}
+}
+
+// restore loads all entries from the cache directory. Entries which cannot be read are skipped.
+// Bodies which are not referenced by any entry and files of interrupted writes are deleted.
+func (cache *FileVersionCache) restore() error {
+	files, err := os.ReadDir(cache.directory)
+	if err != nil {
+		return err
+	}
+
+	num := 0
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), temporaryFileSuffix) {
+			// left behind by an interrupted write
+			cache.removeFile(filepath.Join(cache.directory, file.Name()))
+			continue
+		}
+		if file.IsDir() || !strings.HasSuffix(file.Name(), persistedEntrySuffix) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(cache.directory, file.Name()))
+		if err != nil {
+			cache.Logger.Errorw("cannot read cache entry", "file", file.Name(), "err", err)
+			continue
+		}
+
+		var entry VersionEntry
+		err = json.Unmarshal(data, &entry)
+		if err != nil {
+			cache.Logger.Errorw("cannot parse cache entry", "file", file.Name(), "err", err)
+			continue
+		}
+
+		entry.Body, err = os.ReadFile(cache.blobFile(entry.BodyHash))
+		if err != nil {
+			cache.Logger.Errorw("cannot read body of cache entry", "file", file.Name(), "hash", entry.BodyHash, "err", err)
+			continue
+		}
+
+		stored := cache.put(entry)
+		cache.persisted[utils.MakeKey(stored.Arch, stored.Channel, stored.Version)] = stored.AccessCount
+		num++
+	}
+
+	cache.removeOrphanedBlobs()
+
+	cache.Logger.Infow("restored cache from disk", "directory", cache.directory, "entries", num)
+	return nil
+}
+
+func (cache *FileVersionCache) removeOrphanedBlobs() {
+	files, err := os.ReadDir(filepath.Join(cache.directory, blobDirectory))
+	if err != nil {
+		cache.Logger.Errorw("cannot read blob directory", "directory", cache.directory, "err", err)
+		return
+	}
+
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+
+	for _, file := range files {
+		if _, ok := cache.blobs[file.Name()]; !ok {
+			cache.removeFile(filepath.Join(cache.directory, blobDirectory, file.Name()))
+		}
+	}
+}
+
+// persist writes the entry and its body to the cache directory. The body is only written if no other entry
+// with the same body has been written before.
+func (cache *FileVersionCache) persist(key string, entry VersionEntry) {
+	blobFile := cache.blobFile(entry.BodyHash)
+	_, err := os.Stat(blobFile)
+	if errors.Is(err, os.ErrNotExist) {
+		err = utils.WriteFileAtomic(blobFile, entry.Body)
+	}
+	if err != nil {
+		cache.Logger.Errorw("cannot write cache body", "key", key, "hash", entry.BodyHash, "err", err)
+		return
+	}
+
+	cache.writeEntry(key, entry)
+}
+
+// writeEntry writes the entry without its body. Must be called with writeLock held.
+func (cache *FileVersionCache) writeEntry(key string, entry VersionEntry) {
+	entry.Body = nil
+	data, err := json.Marshal(entry)
+	if err != nil {
+		cache.Logger.Errorw("cannot serialize cache entry", "key", key, "err", err)
+		return
+	}
+
+	err = utils.WriteFileAtomic(cache.entryFile(key), data)
+	if err != nil {
+		cache.Logger.Errorw("cannot write cache file", "key", key, "err", err)
+		return
+	}
+	cache.persisted[key] = entry.AccessCount
+}
+
+func (cache *FileVersionCache) removeFile(name string) {
+	err := os.Remove(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		cache.Logger.Errorw("cannot delete cache file", "file", name, "err", err)
+	}
+}
+
+func (cache *FileVersionCache) entryFile(key string) string {
+	return filepath.Join(cache.directory, key+persistedEntrySuffix)
+}
+
+func (cache *FileVersionCache) blobFile(hash string) string {
+	return filepath.Join(cache.directory, blobDirectory, hash)
+}
@@ -0,0 +1,166 @@
+package client_test
+
+import (
+	"github.com/lukeelten/openshift-update-proxy/pkg/client"
+	"github.com/lukeelten/openshift-update-proxy/pkg/utils"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openFileVersionCache(t *testing.T, directory string) *client.FileVersionCache {
+	t.Helper()
+
+	store, err := client.NewFileVersionCache(time.Hour, 0, 0, nil, directory, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("cannot open file cache: %v", err)
+	}
+	return store
+}
+
+func countFiles(t *testing.T, pattern string) int {
+	t.Helper()
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(files)
+}
+
+func TestFileVersionCacheRestore(t *testing.T) {
+	directory := t.TempDir()
+	store := openFileVersionCache(t, directory)
+
+	shared := []byte(`{"nodes":[],"edges":[]}`)
+	entry := client.VersionEntry{
+		Arch:         "amd64",
+		Channel:      "stable-4.14",
+		Version:      "4.14.1",
+		Body:         shared,
+		ETag:         `"abc"`,
+		LastModified: "Mon, 02 Jan 2006 15:04:05 GMT",
+		Endpoint:     "https://example.com/graph",
+	}
+	store.Set(entry, time.Minute)
+
+	entry.Version = "4.14.2"
+	store.Set(entry, 2*time.Minute)
+	store.Set(client.VersionEntry{Arch: "amd64", Channel: "stable-4.15", Version: "4.15.0", Body: []byte("other")}, client.DEFAULT_LIFETIME)
+
+	before, err := store.Peek("amd64", "stable-4.14", "4.14.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if blobs := countFiles(t, filepath.Join(directory, "blobs", "*")); blobs != 2 {
+		t.Errorf("expected 2 blobs for 3 entries, got %d", blobs)
+	}
+
+	// leftovers of an interrupted run
+	for _, name := range []string{filepath.Join("blobs", "orphaned"), "amd64.json.123.tmp", filepath.Join("blobs", "abc.456.tmp")} {
+		err := os.WriteFile(filepath.Join(directory, name), []byte("garbage"), 0o640)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	restored := openFileVersionCache(t, directory)
+	if restored.Size() != 3 {
+		t.Fatalf("expected 3 restored entries, got %v", restored.Size())
+	}
+	if restored.Bytes() != float64(len(shared)+len("other")) {
+		t.Errorf("shared body counted more than once: %v bytes", restored.Bytes())
+	}
+
+	after, err := restored.Peek("amd64", "stable-4.14", "4.14.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(after.Body) != string(shared) {
+		t.Errorf("body not restored: %q", after.Body)
+	}
+	if !after.ValidUntil.Equal(before.ValidUntil) {
+		t.Errorf("expected valid until %v, got %v", before.ValidUntil, after.ValidUntil)
+	}
+	if after.ETag != entry.ETag || after.LastModified != entry.LastModified || after.Endpoint != entry.Endpoint {
+		t.Errorf("validators not restored: %+v", after)
+	}
+
+	second, err := restored.Peek("amd64", "stable-4.14", "4.14.2")
+	if err != nil || string(second.Body) != string(shared) || second.BodyHash != after.BodyHash {
+		t.Errorf("shared body not restored: %+v, %v", second, err)
+	}
+
+	if blobs := countFiles(t, filepath.Join(directory, "blobs", "*")); blobs != 2 {
+		t.Errorf("orphaned blobs not removed, %d blobs left", blobs)
+	}
+	if tmp := countFiles(t, filepath.Join(directory, "*.tmp")) + countFiles(t, filepath.Join(directory, "blobs", "*.tmp")); tmp != 0 {
+		t.Errorf("temporary files not removed, %d left", tmp)
+	}
+
+	// the shared body is kept until the last entry referencing it is deleted
+	restored.Delete("amd64", "stable-4.14", "4.14.1")
+	if blobs := countFiles(t, filepath.Join(directory, "blobs", "*")); blobs != 2 {
+		t.Errorf("shared blob removed while still referenced, %d blobs left", blobs)
+	}
+	restored.Delete("amd64", "stable-4.14", "4.14.2")
+	if blobs := countFiles(t, filepath.Join(directory, "blobs", "*")); blobs != 1 {
+		t.Errorf("unreferenced blob not removed, %d blobs left", blobs)
+	}
+
+	if reopened := openFileVersionCache(t, directory); reopened.Size() != 1 {
+		t.Errorf("deleted entries restored, %v entries", reopened.Size())
+	}
+}
+
+func TestFileVersionCacheFlush(t *testing.T) {
+	directory := t.TempDir()
+	store := openFileVersionCache(t, directory)
+
+	store.Set(client.VersionEntry{Arch: "amd64", Channel: "stable-4.14", Version: "4.14.1", Body: []byte("body")}, client.DEFAULT_LIFETIME)
+	store.Set(client.VersionEntry{Arch: "amd64", Channel: "stable-4.14", Version: "4.14.2", Body: []byte("body")}, client.DEFAULT_LIFETIME)
+
+	for i := 0; i < 3; i++ {
+		if _, err := store.Get("amd64", "stable-4.14", "4.14.1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	accessed, _ := store.Peek("amd64", "stable-4.14", "4.14.1")
+	untouched, _ := store.Peek("amd64", "stable-4.14", "4.14.2")
+
+	// without flush, the statistics of the last set are restored
+	if restored, _ := openFileVersionCache(t, directory).Peek("amd64", "stable-4.14", "4.14.1"); restored.AccessCount != 0 {
+		t.Errorf("expected access count of last set before flush, got %d", restored.AccessCount)
+	}
+
+	store.Flush()
+
+	reopened := openFileVersionCache(t, directory)
+	restored, err := reopened.Peek("amd64", "stable-4.14", "4.14.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restored.AccessCount != 3 || !restored.LastAccessed.Equal(accessed.LastAccessed) {
+		t.Errorf("expected access count 3 at %v, got %d at %v", accessed.LastAccessed, restored.AccessCount, restored.LastAccessed)
+	}
+
+	restored, _ = reopened.Peek("amd64", "stable-4.14", "4.14.2")
+	if restored.AccessCount != 0 || !restored.LastAccessed.Equal(untouched.LastAccessed) {
+		t.Errorf("statistics of untouched entry changed: %+v", restored)
+	}
+
+	// entries without new accesses are not written again
+	file := filepath.Join(directory, utils.MakeKey("amd64", "stable-4.14", "4.14.1")+".json")
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	store.Flush()
+	if after, _ := os.Stat(file); !after.ModTime().Equal(info.ModTime()) {
+		t.Error("unchanged entry was written again")
+	}
+}
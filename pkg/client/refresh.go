@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RefreshEntries reloads all expired entries using a pool of RefreshWorkers workers. The entries which expired
+// first are refreshed first. The cycle is bounded by RefreshDeadline; entries which have not been refreshed by
+// then are left for the next cycle. Once ctx is done, the remaining entries are skipped as well.
+func (client *OpenShiftVersionClient) RefreshEntries(ctx context.Context) {
+	startTime := time.Now()
+	defer func() {
+		client.metrics.RefreshCycleDuration.WithLabelValues(client.name).Observe(time.Since(startTime).Seconds())
+		client.metrics.RefreshQueueDepth.WithLabelValues(client.name).Set(0)
+		client.updateCacheMetrics()
+	}()
+
+	expired := client.expiredEntries(startTime)
+	if len(expired) == 0 {
+		return
+	}
+
+	if deadline := client.refreshDeadline(); deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
+	}
+
+	queue := make(chan VersionEntry, len(expired))
+	for _, entry := range expired {
+		queue <- entry
+	}
+	close(queue)
+	client.metrics.RefreshQueueDepth.WithLabelValues(client.name).Set(float64(len(queue)))
+
+	workers := client.config.Cache.RefreshWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > len(expired) {
+		workers = len(expired)
+	}
+
+	client.logger.Infow("start refresh cycle", "entries", len(expired), "workers", workers)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.refreshWorker(ctx, queue)
+		}()
+	}
+	wg.Wait()
+
+	if skipped := len(queue); skipped > 0 {
+		client.logger.Warnw("refresh cycle exceeded deadline, skipped remaining entries", "skipped", skipped, "deadline", client.refreshDeadline())
+		client.metrics.RefreshSkipped.WithLabelValues(client.name).Add(float64(skipped))
+	}
+
+	client.logger.Infow("finished refresh cycle", "entries", len(expired), "duration", time.Since(startTime))
+}
+
+func (client *OpenShiftVersionClient) refreshWorker(ctx context.Context, queue <-chan VersionEntry) {
+	for ctx.Err() == nil {
+		entry, ok := <-queue
+		if !ok {
+			return
+		}
+		client.metrics.RefreshQueueDepth.WithLabelValues(client.name).Set(float64(len(queue)))
+
+		client.logger.Debugw("start refresh entry", "entry", entry)
+		client.refresh(ctx, entry.Arch, entry.Channel, entry.Version)
+	}
+}
+
+// expiredEntries returns all entries expired at the given time, ordered by expiry
+func (client *OpenShiftVersionClient) expiredEntries(now time.Time) []VersionEntry {
+	expired := make([]VersionEntry, 0)
+	client.cache.Foreach(func(entry VersionEntry) {
+		if now.After(entry.ValidUntil) {
+			expired = append(expired, entry)
+		}
+	})
+
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].ValidUntil.Before(expired[j].ValidUntil)
+	})
+	return expired
+}
+
+func (client *OpenShiftVersionClient) refreshDeadline() time.Duration {
+	if client.config.Cache.RefreshDeadline > 0 {
+		return client.config.Cache.RefreshDeadline
+	}
+	return client.config.Cache.ControllerCycle
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// upstreamError is returned for failed requests to an upstream endpoint
+type upstreamError struct {
+	err        error
+	statusCode int
+	// retryAfter is the delay requested by the upstream with a Retry-After header
+	retryAfter time.Duration
+	retryable  bool
+}
+
+func (e *upstreamError) Error() string {
+	if e.statusCode > 0 {
+		return fmt.Sprintf("got error response: %d %s", e.statusCode, http.StatusText(e.statusCode))
+	}
+	return e.err.Error()
+}
+
+func (e *upstreamError) Unwrap() error {
+	return e.err
+}
+
+// statusError creates the error for an error response. Server errors and 429 are retryable.
+func statusError(res *http.Response) error {
+	return &upstreamError{
+		statusCode: res.StatusCode,
+		retryAfter: parseRetryAfter(res.Header.Get("Retry-After"), time.Now()),
+		retryable:  res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests,
+	}
+}
+
+// transportError creates the error for a failed connection. These are retryable unless the context is done.
+func transportError(ctx context.Context, err error) error {
+	return &upstreamError{
+		err:       err,
+		retryable: ctx.Err() == nil,
+	}
+}
+
+// invalidResponseError creates the error for a response which is not a valid graph. These are retryable, as
+// another endpoint or a later attempt may return a valid graph.
+func invalidResponseError(err error) error {
+	return &upstreamError{
+		err:       fmt.Errorf("invalid response: %w", err),
+		retryable: true,
+	}
+}
+
+func isRetryable(err error) bool {
+	var upstreamErr *upstreamError
+	return errors.As(err, &upstreamErr) && upstreamErr.retryable
+}
+
+func retryAfter(err error) time.Duration {
+	var upstreamErr *upstreamError
+	if errors.As(err, &upstreamErr) {
+		return upstreamErr.retryAfter
+	}
+	return 0
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
+
+// backoff returns the delay before the given retry (starting at 1): exponential growth from initial,
+// capped at max if max is set, with a random jitter of up to half of the delay.
+func backoff(retry int, initial, max time.Duration) time.Duration {
+	delay := initial
+	for i := 1; i < retry && (max <= 0 || delay < max) && delay < math.MaxInt64/2; i++ {
+		delay *= 2
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+
+	if delay <= 1 {
+		return delay
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)))
+}
+
+// sleep waits for the delay or until the context is done. Returns false if the context is done.
+func sleep(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,211 @@
+package client
+
+import (
+	"context"
+	"github.com/lukeelten/openshift-update-proxy/pkg/config"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		delay time.Duration
+	}{
+		{name: "empty", value: "", delay: 0},
+		{name: "seconds", value: "120", delay: 2 * time.Minute},
+		{name: "seconds with whitespace", value: " 5 ", delay: 5 * time.Second},
+		{name: "zero seconds", value: "0", delay: 0},
+		{name: "negative seconds", value: "-5", delay: 0},
+		{name: "http date", value: now.Add(90 * time.Second).Format(http.TimeFormat), delay: 90 * time.Second},
+		{name: "http date in the past", value: now.Add(-time.Minute).Format(http.TimeFormat), delay: 0},
+		{name: "http date now", value: now.Format(http.TimeFormat), delay: 0},
+		{name: "invalid", value: "soon", delay: 0},
+		{name: "fractional seconds", value: "1.5", delay: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if delay := parseRetryAfter(test.value, now); delay != test.delay {
+				t.Errorf("expected %v, got %v", test.delay, delay)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		retry   int
+		initial time.Duration
+		max     time.Duration
+		delay   time.Duration
+	}{
+		{name: "first retry", retry: 1, initial: time.Second, max: time.Minute, delay: time.Second},
+		{name: "second retry", retry: 2, initial: time.Second, max: time.Minute, delay: 2 * time.Second},
+		{name: "fourth retry", retry: 4, initial: time.Second, max: time.Minute, delay: 8 * time.Second},
+		{name: "capped", retry: 10, initial: time.Second, max: 5 * time.Second, delay: 5 * time.Second},
+		{name: "initial above max", retry: 1, initial: time.Minute, max: 5 * time.Second, delay: 5 * time.Second},
+		{name: "no max", retry: 3, initial: time.Second, max: 0, delay: 4 * time.Second},
+		{name: "many retries are capped", retry: 1000, initial: time.Second, max: time.Minute, delay: time.Minute},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			varies := false
+			first := backoff(test.retry, test.initial, test.max)
+			for i := 0; i < 100; i++ {
+				delay := backoff(test.retry, test.initial, test.max)
+				// the jitter takes up to half of the delay
+				if delay < test.delay/2 || delay > test.delay {
+					t.Fatalf("expected delay between %v and %v, got %v", test.delay/2, test.delay, delay)
+				}
+				varies = varies || delay != first
+			}
+			if !varies {
+				t.Error("jitter not applied")
+			}
+		})
+	}
+}
+
+// statusUpstream answers the first failures requests with status and header, then serves testGraph
+type statusUpstream struct {
+	status   int
+	header   http.Header
+	failures int32
+	requests atomic.Int32
+}
+
+func (upstream *statusUpstream) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if upstream.requests.Add(1) <= upstream.failures {
+		for name, values := range upstream.header {
+			writer.Header()[name] = values
+		}
+		writer.WriteHeader(upstream.status)
+		return
+	}
+	writer.Write([]byte(testGraph))
+}
+
+func newTestUpstreamClient(t *testing.T, handler http.Handler, retry config.RetryConfig) *UpstreamClient {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	upstream, err := NewUpstreamClient(zap.NewNop().Sugar(), newTestMetrics(), config.UpstreamConfig{
+		Name:           "test",
+		Endpoints:      []string{server.URL},
+		Timeout:        time.Second,
+		Retry:          retry,
+		CircuitBreaker: config.CircuitBreakerConfig{FailureThreshold: 100, OpenDuration: time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("cannot create upstream client: %v", err)
+	}
+	return upstream
+}
+
+func TestLoadWithRetry(t *testing.T) {
+	retry := config.RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond, Deadline: 5 * time.Second}
+
+	tests := []struct {
+		name     string
+		status   int
+		failures int32
+		success  bool
+		requests int32
+	}{
+		{name: "no failure", status: http.StatusServiceUnavailable, failures: 0, success: true, requests: 1},
+		{name: "recovers within attempts", status: http.StatusServiceUnavailable, failures: 2, success: true, requests: 3},
+		{name: "too many requests is retried", status: http.StatusTooManyRequests, failures: 1, success: true, requests: 2},
+		{name: "gives up after max attempts", status: http.StatusBadGateway, failures: 3, success: false, requests: 3},
+		{name: "client errors are not retried", status: http.StatusNotFound, failures: 1, success: false, requests: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := &statusUpstream{status: test.status, failures: test.failures}
+			upstream := newTestUpstreamClient(t, handler, retry)
+
+			response, err := upstream.loadWithRetry(context.Background(), "amd64", "stable-4.14", "4.14.1", "", "")
+			if test.success && (err != nil || string(response.Body) != testGraph) {
+				t.Errorf("expected response, got %v", err)
+			}
+			if !test.success && err == nil {
+				t.Error("expected error")
+			}
+			if requests := handler.requests.Load(); requests != test.requests {
+				t.Errorf("expected %d requests, got %d", test.requests, requests)
+			}
+		})
+	}
+}
+
+func TestLoadWithRetryDeadline(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		backoff    time.Duration
+	}{
+		{name: "Retry-After exceeds deadline", retryAfter: "10", backoff: time.Millisecond},
+		{name: "backoff exceeds deadline", backoff: 10 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			if len(test.retryAfter) > 0 {
+				header.Set("Retry-After", test.retryAfter)
+			}
+			handler := &statusUpstream{status: http.StatusServiceUnavailable, header: header, failures: 10}
+			retry := config.RetryConfig{MaxAttempts: 5, InitialBackoff: test.backoff, MaxBackoff: test.backoff, Deadline: 500 * time.Millisecond}
+			upstream := newTestUpstreamClient(t, handler, retry)
+
+			start := time.Now()
+			_, err := upstream.loadWithRetry(context.Background(), "amd64", "stable-4.14", "4.14.1", "", "")
+			if err == nil {
+				t.Fatal("expected error")
+			}
+
+			// the retry is abandoned right away instead of waiting until the deadline
+			if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+				t.Errorf("expected to give up immediately, took %v", elapsed)
+			}
+			if requests := handler.requests.Load(); requests != 1 {
+				t.Errorf("expected 1 request, got %d", requests)
+			}
+		})
+	}
+}
+
+func TestLoadWithRetryHonorsRetryAfter(t *testing.T) {
+	header := http.Header{}
+	header.Set("Retry-After", "1")
+	handler := &statusUpstream{status: http.StatusServiceUnavailable, header: header, failures: 1}
+	retry := config.RetryConfig{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Deadline: 5 * time.Second}
+	upstream := newTestUpstreamClient(t, handler, retry)
+
+	start := time.Now()
+	_, err := upstream.loadWithRetry(context.Background(), "amd64", "stable-4.14", "4.14.1", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected to wait for Retry-After, retried after %v", elapsed)
+	}
+}
+
+func TestBackoffWithoutMaxDoesNotOverflow(t *testing.T) {
+	if delay := backoff(1000, time.Second, 0); delay <= 0 {
+		t.Errorf("expected positive delay, got %v", delay)
+	}
+}
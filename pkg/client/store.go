@@ -0,0 +1,67 @@
+package client
+
+import (
+	"fmt"
+	"github.com/lukeelten/openshift-update-proxy/pkg/config"
+	"go.uber.org/zap"
+	"path/filepath"
+	"time"
+)
+
+const (
+	CACHE_STORE_MEMORY = "memory"
+	CACHE_STORE_FILE   = "file"
+
+	// DEFAULT_LIFETIME makes Set use the default lifetime of the store
+	DEFAULT_LIFETIME time.Duration = -1
+)
+
+// CacheStore is the storage backend of an OpenShiftVersionClient.
+// Implementations must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns an entry including its body or utils.ERR_NOT_FOUND and records an access to the entry
+	Get(arch, channel, version string) (VersionEntry, error)
+	// Peek is like Get, but does not record an access
+	Peek(arch, channel, version string) (VersionEntry, error)
+	// Set creates or replaces an entry, which stays valid for the given lifetime. A lifetime of 0 expires the entry
+	// immediately, DEFAULT_LIFETIME uses the default lifetime of the store. ValidUntil and the access statistics
+	// are set by the store; replacing an entry keeps its access statistics.
+	Set(entry VersionEntry, lifetime time.Duration)
+	// Delete removes an entry. Deleting a missing entry is not an error.
+	Delete(arch, channel, version string)
+	// Foreach calls foreachFunc for every entry. Entries are passed without body.
+	// The store may be modified from within foreachFunc.
+	Foreach(foreachFunc ForeachFunc)
+	Size() float64
+	// Bytes returns the total size of all bodies in the store. Identical bodies are counted once.
+	Bytes() float64
+	HasKey(arch, channel, version string) bool
+	// Flush writes access statistics which changed since the entries were stored to persistent storage.
+	// Stores without persistent storage do nothing.
+	Flush()
+}
+
+// NewCacheStore creates the cache store configured in cfg.Cache.Store for the upstream with the given name.
+// onEvict is called for entries evicted due to the configured size limits and may be nil.
+func NewCacheStore(cfg *config.UpdateProxyConfig, name string, onEvict EvictionFunc, logger *zap.SugaredLogger) (CacheStore, error) {
+	store := cfg.Cache.Store
+	if len(store) == 0 {
+		store = CACHE_STORE_MEMORY
+		if len(cfg.Cache.Directory) > 0 {
+			store = CACHE_STORE_FILE
+		}
+	}
+
+	switch store {
+	case CACHE_STORE_MEMORY:
+		return NewOpenShiftVersionCache(cfg.Cache.DefaultLifetime, cfg.Cache.MaxEntries, cfg.Cache.MaxBytes, onEvict, logger), nil
+
+	case CACHE_STORE_FILE:
+		if len(cfg.Cache.Directory) == 0 {
+			return nil, fmt.Errorf("cache store %q requires a cache directory", store)
+		}
+		return NewFileVersionCache(cfg.Cache.DefaultLifetime, cfg.Cache.MaxEntries, cfg.Cache.MaxBytes, onEvict, filepath.Join(cfg.Cache.Directory, name), logger)
+	}
+
+	return nil, fmt.Errorf("unknown cache store %q", store)
+}
@@ -0,0 +1,25 @@
+package client_test
+
+import (
+	"github.com/lukeelten/openshift-update-proxy/pkg/client"
+	"github.com/lukeelten/openshift-update-proxy/pkg/client/cachetest"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestOpenShiftVersionCache(t *testing.T) {
+	cachetest.TestCacheStore(t, func(t *testing.T) client.CacheStore {
+		return client.NewOpenShiftVersionCache(time.Hour, 0, 0, nil, zap.NewNop().Sugar())
+	})
+}
+
+func TestFileVersionCache(t *testing.T) {
+	cachetest.TestCacheStore(t, func(t *testing.T) client.CacheStore {
+		store, err := client.NewFileVersionCache(time.Hour, 0, 0, nil, t.TempDir(), zap.NewNop().Sugar())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
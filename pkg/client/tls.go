@@ -0,0 +1,185 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/lukeelten/openshift-update-proxy/pkg/config"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// reloadingTransport rebuilds the underlying transport when one of the configured TLS files changes,
+// so rotated certificates are picked up without a restart. Connections of the previous transport are
+// closed once they become idle.
+type reloadingTransport struct {
+	logger *zap.SugaredLogger
+	cfg    config.UpstreamConfig
+
+	lock      sync.RWMutex
+	transport *http.Transport
+	files     map[string]fileVersion
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+var _ http.RoundTripper = &reloadingTransport{}
+
+func newReloadingTransport(cfg config.UpstreamConfig, logger *zap.SugaredLogger) (*reloadingTransport, error) {
+	rt := &reloadingTransport{
+		logger: logger,
+		cfg:    cfg,
+	}
+
+	files := rt.fileVersions()
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	rt.transport = transport
+	rt.files = files
+	return rt, nil
+}
+
+func (rt *reloadingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.reloadIfChanged()
+
+	rt.lock.RLock()
+	transport := rt.transport
+	rt.lock.RUnlock()
+
+	return transport.RoundTrip(req)
+}
+
+func (rt *reloadingTransport) reloadIfChanged() {
+	files := rt.fileVersions()
+
+	rt.lock.RLock()
+	changed := !sameFiles(files, rt.files)
+	rt.lock.RUnlock()
+
+	if !changed {
+		return
+	}
+
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	if sameFiles(files, rt.files) {
+		return
+	}
+
+	transport, err := newTransport(rt.cfg)
+	if err != nil {
+		// keep the previous transport, the files might be in the middle of being replaced
+		rt.logger.Errorw("cannot reload TLS configuration, keep previous configuration", "err", err)
+		return
+	}
+
+	rt.logger.Infow("reloaded TLS configuration")
+	rt.transport.CloseIdleConnections()
+	rt.transport = transport
+	rt.files = files
+}
+
+func (rt *reloadingTransport) CloseIdleConnections() {
+	rt.lock.RLock()
+	defer rt.lock.RUnlock()
+
+	rt.transport.CloseIdleConnections()
+}
+
+func (rt *reloadingTransport) fileVersions() map[string]fileVersion {
+	files := make(map[string]fileVersion)
+	for _, name := range []string{rt.cfg.TLS.CAFile, rt.cfg.TLS.ClientCertFile, rt.cfg.TLS.ClientKeyFile} {
+		if len(name) == 0 {
+			continue
+		}
+
+		info, err := os.Stat(name)
+		if err != nil {
+			files[name] = fileVersion{}
+			continue
+		}
+		files[name] = fileVersion{modTime: info.ModTime(), size: info.Size()}
+	}
+	return files
+}
+
+func (version fileVersion) equal(other fileVersion) bool {
+	return version.modTime.Equal(other.modTime) && version.size == other.size
+}
+
+func sameFiles(a, b map[string]fileVersion) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, version := range a {
+		if other, ok := b[name]; !ok || !version.equal(other) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasTLSFiles returns true if the upstream references files which need to be watched for changes.
+func hasTLSFiles(cfg config.TLSConfig) bool {
+	return len(cfg.CAFile) > 0 || len(cfg.ClientCertFile) > 0
+}
+
+func newTLSConfig(cfg config.UpstreamConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.TLS.ServerName,
+		InsecureSkipVerify: cfg.Insecure,
+	}
+
+	if len(cfg.TLS.MinVersion) > 0 {
+		version, ok := tlsVersions[cfg.TLS.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS version %q", cfg.TLS.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if len(cfg.TLS.CAFile) > 0 {
+		pem, err := os.ReadFile(cfg.TLS.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA file: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("CA file does not contain any certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(cfg.TLS.ClientCertFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.ClientCertFile, cfg.TLS.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"fmt"
+	"github.com/lukeelten/openshift-update-proxy/pkg/config"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// newUpstreamTransport creates the transport for an upstream. If the upstream references TLS files,
+// the transport is rebuilt whenever one of them changes.
+func newUpstreamTransport(cfg config.UpstreamConfig, logger *zap.SugaredLogger) (http.RoundTripper, error) {
+	if hasTLSFiles(cfg.TLS) {
+		return newReloadingTransport(cfg, logger)
+	}
+	return newTransport(cfg)
+}
+
+// newTransport creates the transport for an upstream. Without explicit proxy configuration, the proxy is
+// taken from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func newTransport(cfg config.UpstreamConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	proxyFunc, err := proxyFunc(cfg.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxyFunc
+
+	return transport, nil
+}
+
+// proxyFunc returns the proxy selection for the transport. The proxy credentials are part of the proxy URL,
+// which makes the transport send them for plain HTTP requests as well as for CONNECT tunnels.
+func proxyFunc(cfg config.ProxyConfig) (func(*http.Request) (*url.URL, error), error) {
+	if len(cfg.URL) == 0 {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	proxyUrl, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+	if len(proxyUrl.Scheme) == 0 || len(proxyUrl.Host) == 0 {
+		return nil, fmt.Errorf("invalid proxy url %q: scheme and host required", cfg.URL)
+	}
+
+	if len(cfg.Username) > 0 {
+		proxyUrl.User = url.UserPassword(cfg.Username, cfg.Password)
+	}
+
+	noProxy := newNoProxyMatcher(cfg.NoProxy)
+
+	return func(req *http.Request) (*url.URL, error) {
+		if noProxy.matches(req.URL) {
+			return nil, nil
+		}
+		return proxyUrl, nil
+	}, nil
+}
+
+// noProxyMatcher implements the NO_PROXY conventions: "*" matches every host, a domain matches the domain
+// and all its subdomains (with or without leading dot or "*."), IP addresses and CIDR ranges match the address.
+// Entries may be restricted to a port with host:port.
+type noProxyMatcher struct {
+	all      bool
+	networks []*net.IPNet
+	entries  []noProxyEntry
+}
+
+type noProxyEntry struct {
+	host string
+	port string
+}
+
+func newNoProxyMatcher(entries []string) *noProxyMatcher {
+	matcher := &noProxyMatcher{}
+
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if len(entry) == 0 {
+			continue
+		}
+
+		if entry == "*" {
+			matcher.all = true
+			continue
+		}
+
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			matcher.networks = append(matcher.networks, network)
+			continue
+		}
+
+		host, port, err := net.SplitHostPort(entry)
+		if err != nil {
+			host, port = entry, ""
+		}
+		matcher.entries = append(matcher.entries, noProxyEntry{
+			host: strings.TrimPrefix(strings.TrimPrefix(strings.Trim(host, "[]"), "*"), "."),
+			port: port,
+		})
+	}
+
+	return matcher
+}
+
+func (matcher *noProxyMatcher) matches(target *url.URL) bool {
+	if matcher.all {
+		return true
+	}
+
+	host := strings.ToLower(target.Hostname())
+	port := target.Port()
+	if len(port) == 0 {
+		port = "80"
+		if target.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		for _, network := range matcher.networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	for _, entry := range matcher.entries {
+		if len(entry.port) > 0 && entry.port != port {
+			continue
+		}
+		if host == entry.host || strings.HasSuffix(host, "."+entry.host) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"github.com/lukeelten/openshift-update-proxy/pkg/config"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestNoProxyMatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		target  string
+		matches bool
+	}{
+		{name: "no entries", entries: []string{}, target: "https://example.com", matches: false},
+		{name: "empty entries", entries: []string{"", " "}, target: "https://example.com", matches: false},
+		{name: "wildcard", entries: []string{"*"}, target: "https://example.com", matches: true},
+		{name: "exact host", entries: []string{"example.com"}, target: "https://example.com", matches: true},
+		{name: "subdomain", entries: []string{"example.com"}, target: "https://api.example.com", matches: true},
+		{name: "nested subdomain", entries: []string{"example.com"}, target: "https://a.b.example.com", matches: true},
+		{name: "suffix without dot", entries: []string{"example.com"}, target: "https://badexample.com", matches: false},
+		{name: "other domain", entries: []string{"example.com"}, target: "https://example.org", matches: false},
+		{name: "leading dot matches domain", entries: []string{".example.com"}, target: "https://example.com", matches: true},
+		{name: "leading dot matches subdomain", entries: []string{".example.com"}, target: "https://api.example.com", matches: true},
+		{name: "wildcard subdomain", entries: []string{"*.example.com"}, target: "https://api.example.com", matches: true},
+		{name: "case insensitive", entries: []string{"Example.COM"}, target: "https://API.example.com", matches: true},
+		{name: "whitespace", entries: []string{" example.com "}, target: "https://example.com", matches: true},
+		{name: "host with port", entries: []string{"example.com:8443"}, target: "https://example.com:8443", matches: true},
+		{name: "host with other port", entries: []string{"example.com:8443"}, target: "https://example.com", matches: false},
+		{name: "default https port", entries: []string{"example.com:443"}, target: "https://example.com", matches: true},
+		{name: "default http port", entries: []string{"example.com:80"}, target: "http://example.com", matches: true},
+		{name: "entry without port matches any port", entries: []string{"example.com"}, target: "https://example.com:8443", matches: true},
+		{name: "ip address", entries: []string{"10.0.0.1"}, target: "https://10.0.0.1", matches: true},
+		{name: "other ip address", entries: []string{"10.0.0.1"}, target: "https://10.0.0.2", matches: false},
+		{name: "ip address with port", entries: []string{"10.0.0.1:8443"}, target: "https://10.0.0.1:8443", matches: true},
+		{name: "cidr", entries: []string{"10.0.0.0/8"}, target: "https://10.1.2.3", matches: true},
+		{name: "outside cidr", entries: []string{"10.0.0.0/8"}, target: "https://192.168.0.1", matches: false},
+		{name: "cidr does not match hostname", entries: []string{"10.0.0.0/8"}, target: "https://example.com", matches: false},
+		{name: "ipv6 cidr", entries: []string{"fd00::/8"}, target: "https://[fd00::1]", matches: true},
+		{name: "ipv6 address with port", entries: []string{"[::1]:8443"}, target: "https://[::1]:8443", matches: true},
+		{name: "one of several entries", entries: []string{"example.org", "10.0.0.0/8", "example.com"}, target: "https://api.example.com", matches: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target, err := url.Parse(test.target)
+			if err != nil {
+				t.Fatalf("invalid target: %v", err)
+			}
+
+			if matches := newNoProxyMatcher(test.entries).matches(target); matches != test.matches {
+				t.Errorf("expected %v, got %v", test.matches, matches)
+			}
+		})
+	}
+}
+
+func TestProxyFunc(t *testing.T) {
+	proxy, err := proxyFunc(config.ProxyConfig{
+		URL:      "http://proxy.example.com:3128",
+		Username: "user",
+		Password: "secret",
+		NoProxy:  []string{"internal.example.com"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, "https://api.openshift.com/graph", nil)
+	proxyUrl, err := proxy(request)
+	if err != nil || proxyUrl == nil {
+		t.Fatalf("expected proxy, got %v (%v)", proxyUrl, err)
+	}
+	if password, _ := proxyUrl.User.Password(); proxyUrl.Host != "proxy.example.com:3128" || password != "secret" {
+		t.Errorf("unexpected proxy %v", proxyUrl.Redacted())
+	}
+
+	request, _ = http.NewRequest(http.MethodGet, "https://graph.internal.example.com/graph", nil)
+	if proxyUrl, err := proxy(request); err != nil || proxyUrl != nil {
+		t.Errorf("expected direct connection, got %v (%v)", proxyUrl, err)
+	}
+}
+
+func TestProxyFuncInvalid(t *testing.T) {
+	tests := []string{"proxy.example.com:3128", "http://", "://proxy"}
+
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			if _, err := proxyFunc(config.ProxyConfig{URL: test}); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package client
 
 import (
-	"crypto/tls"
+	"context"
 	"errors"
+	"github.com/lukeelten/openshift-update-proxy/pkg/config"
+	"github.com/lukeelten/openshift-update-proxy/pkg/graph"
 	"github.com/lukeelten/openshift-update-proxy/pkg/metrics"
 	"github.com/lukeelten/openshift-update-proxy/pkg/utils"
 	"go.uber.org/zap"
@@ -18,76 +20,265 @@ type UpstreamClient struct {
 
 	Client http.Client
 
+	Name string
+	// Endpoints in priority order
+	Endpoints        []*UpstreamEndpoint
+	FailoverCooldown time.Duration
+
+	Retry config.RetryConfig
+
+	Breaker *CircuitBreaker
+
+	Auth *UpstreamAuth
+}
+
+type UpstreamResponse struct {
+	Body []byte
+
+	ETag         string
+	LastModified string
+
+	// Lifetime is the freshness announced by the upstream. Only valid if HasLifetime is set.
+	Lifetime    time.Duration
+	HasLifetime bool
+
+	// Endpoint which served the response
 	Endpoint string
+
+	// NotModified is set if the upstream confirmed that the cached entry is still up to date. Body is empty in this case.
+	NotModified bool
 }
 
-func NewUpstreamClient(logger *zap.SugaredLogger, metric *metrics.UpdateProxyMetrics, endpoint string, insecure bool, timeout time.Duration) *UpstreamClient {
+func NewUpstreamClient(logger *zap.SugaredLogger, metric *metrics.UpdateProxyMetrics, cfg config.UpstreamConfig) (*UpstreamClient, error) {
+	transport, err := newUpstreamTransport(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
 	client := http.Client{
-		Timeout: timeout,
+		Timeout:   cfg.Timeout,
+		Transport: transport,
+	}
+
+	endpoints := make([]*UpstreamEndpoint, 0, len(cfg.Endpoints))
+	for _, endpoint := range cfg.Endpoints {
+		endpoints = append(endpoints, NewUpstreamEndpoint(endpoint))
+		metric.UpstreamEndpointHealthy.WithLabelValues(cfg.Name, endpoint).Set(1)
+	}
+
+	breaker := NewCircuitBreaker(cfg.CircuitBreaker.FailureThreshold, cfg.CircuitBreaker.OpenDuration, func(state CircuitState) {
+		metric.UpstreamCircuitState.WithLabelValues(cfg.Name).Set(float64(state))
+	}, logger)
+	metric.UpstreamCircuitState.WithLabelValues(cfg.Name).Set(float64(CIRCUIT_CLOSED))
+
+	return &UpstreamClient{
+		Logger:           logger,
+		Metrics:          metric,
+		Client:           client,
+		Name:             cfg.Name,
+		Endpoints:        endpoints,
+		FailoverCooldown: cfg.FailoverCooldown,
+		Retry:            cfg.Retry,
+		Breaker:          breaker,
+		Auth:             NewUpstreamAuth(cfg),
+	}, nil
+}
+
+// LoadVersionInfo requests the version graph from upstream. If etag or lastModified are given, the request is sent
+// as conditional request and the response may indicate that the cached version is still up to date.
+// The endpoints of the upstream are tried in order until one of them returns a valid response. If all endpoints
+// fail with a transient error, the request is retried with exponential backoff until the retry deadline.
+// While the circuit breaker of the upstream is open, requests fail immediately with utils.ERR_CIRCUIT_OPEN.
+// Cancelling ctx aborts the request including all pending retries.
+func (client *UpstreamClient) LoadVersionInfo(ctx context.Context, arch, channel, version, etag, lastModified string) (*UpstreamResponse, error) {
+	if !client.Breaker.Allow() {
+		client.Logger.Debugw("circuit breaker open, skip upstream request", "arch", arch, "channel", channel, "version", version)
+		return nil, utils.ERR_CIRCUIT_OPEN
+	}
+
+	response, err := client.loadWithRetry(ctx, arch, channel, version, etag, lastModified)
+	if err == nil {
+		client.Breaker.Success()
+	} else if ctx.Err() != nil {
+		// cancelled by the caller, this says nothing about the upstream
+		client.Breaker.Release()
+	} else if isRetryable(err) || errors.Is(err, context.DeadlineExceeded) {
+		client.Breaker.Failure()
+	} else {
+		// the upstream is reachable, but rejected the request
+		client.Breaker.Success()
+	}
+
+	return response, err
+}
+
+func (client *UpstreamClient) loadWithRetry(ctx context.Context, arch, channel, version, etag, lastModified string) (*UpstreamResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, client.Retry.Deadline)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		response, err := client.tryEndpoints(ctx, arch, channel, version, etag, lastModified)
+		if err == nil {
+			return response, nil
+		}
+
+		if !isRetryable(err) || attempt >= client.Retry.MaxAttempts {
+			return nil, err
+		}
+
+		delay := backoff(attempt, client.Retry.InitialBackoff, client.Retry.MaxBackoff)
+		if after := retryAfter(err); after > delay {
+			delay = after
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			client.Logger.Debugw("retry would exceed deadline, give up", "attempt", attempt, "delay", delay, "err", err)
+			return nil, err
+		}
+
+		client.Logger.Infow("retry upstream request", "arch", arch, "channel", channel, "version", version, "attempt", attempt, "delay", delay, "err", err)
+		client.Metrics.UpstreamRetries.WithLabelValues(client.Name).Inc()
+
+		if !sleep(ctx, delay) {
+			return nil, err
+		}
 	}
-	if insecure {
-		tlsConfig := tls.Config{
-			InsecureSkipVerify: true,
+}
+
+// tryEndpoints tries all endpoints in order. Endpoints failing with a transient error are skipped for the cooldown.
+func (client *UpstreamClient) tryEndpoints(ctx context.Context, arch, channel, version, etag, lastModified string) (*UpstreamResponse, error) {
+	var lastErr error
+
+	for _, endpoint := range client.orderedEndpoints() {
+		if ctx.Err() != nil {
+			break
+		}
+
+		response, err := client.loadFromEndpoint(ctx, endpoint, arch, channel, version, etag, lastModified)
+		if err == nil {
+			client.endpointSucceeded(endpoint)
+			return response, nil
 		}
-		transport := http.Transport{
-			TLSClientConfig: &tlsConfig,
+
+		if isRetryable(err) {
+			client.endpointFailed(endpoint, err)
+		} else {
+			client.Logger.Debugw("upstream endpoint rejected request", "endpoint", endpoint.URL, "err", err)
 		}
-		client.Transport = &transport
+		lastErr = err
 	}
 
-	return &UpstreamClient{
-		Logger:   logger,
-		Metrics:  metric,
-		Client:   client,
-		Endpoint: endpoint,
+	if lastErr == nil && ctx.Err() != nil {
+		lastErr = ctx.Err()
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no upstream endpoint configured")
 	}
+	return nil, lastErr
 }
 
-func (client *UpstreamClient) LoadVersionInfo(arch, channel, version string) ([]byte, error) {
+func (client *UpstreamClient) loadFromEndpoint(ctx context.Context, endpoint *UpstreamEndpoint, arch, channel, version, etag, lastModified string) (*UpstreamResponse, error) {
 	startTime := time.Now()
 
-	finalUrl, err := client.buildURL(arch, channel, version)
+	finalUrl, err := buildURL(endpoint.URL, arch, channel, version)
 	if err != nil {
-		client.Logger.Debugw("cannot build upstream url", "endpoint", client.Endpoint, "error", err)
-		return []byte{}, err
+		client.Logger.Debugw("cannot build upstream url", "endpoint", endpoint.URL, "error", err)
+		return nil, err
 	}
 
 	client.Logger.Debugw("Create request", "url", finalUrl)
 
-	req, err := http.NewRequest(http.MethodGet, finalUrl, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, finalUrl, nil)
 	if err != nil {
 		client.Logger.Debugw("got error when creating request", "err", err, "url", finalUrl)
-		return []byte{}, err
+		return nil, err
+	}
+
+	err = client.Auth.Apply(req)
+	if err != nil {
+		client.Logger.Errorw("cannot authenticate request", "err", err, "url", finalUrl)
+		return nil, err
+	}
+
+	if len(etag) > 0 {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if len(lastModified) > 0 {
+		req.Header.Set("If-Modified-Since", lastModified)
 	}
 
 	res, err := client.Client.Do(req)
 	if err != nil {
-		client.Logger.Debugw("got error on request", "err", err, "request", req)
-		return []byte{}, err
+		client.Logger.Debugw("got error on request", "err", err, "url", finalUrl, "headers", client.Auth.redactHeaders(req.Header))
+		return nil, transportError(ctx, err)
+	}
+	defer res.Body.Close()
+
+	response := &UpstreamResponse{
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+		Endpoint:     endpoint.URL,
+	}
+	response.Lifetime, response.HasLifetime = utils.FreshnessLifetime(res.Header, time.Now())
+
+	if res.StatusCode == http.StatusNotModified {
+		// Keep the validators of the cached entry if the upstream does not repeat them
+		if len(response.ETag) == 0 {
+			response.ETag = etag
+		}
+		if len(response.LastModified) == 0 {
+			response.LastModified = lastModified
+		}
+		response.NotModified = true
+		client.observeResponseTime(arch, channel, version, startTime)
+		return response, nil
 	}
 
 	if res.StatusCode >= 400 {
-		client.Logger.Debugw("got error response", "response", res, "request", req)
-		return []byte{}, errors.New("got error response")
+		client.Logger.Debugw("got error response", "url", finalUrl, "status", res.StatusCode, "headers", client.Auth.redactHeaders(req.Header), "responseHeaders", client.Auth.redactHeaders(res.Header))
+		return nil, statusError(res)
 	}
 
-	body, err := io.ReadAll(res.Body)
-	defer res.Body.Close()
+	response.Body, err = io.ReadAll(res.Body)
+	if err != nil {
+		client.Logger.Debugw("got error on reading response", "err", err, "url", finalUrl, "status", res.StatusCode)
+		return nil, transportError(ctx, err)
+	}
 
+	g, err := graph.Parse(response.Body)
 	if err != nil {
-		client.Logger.Debugw("got error on reading response", "err", err, "request", req, "response", res)
-		return []byte{}, err
+		// an invalid graph usually comes from a proxy or captive portal in front of the endpoint, so treat it
+		// like a failed endpoint and try the others
+		client.Logger.Warnw("upstream returned invalid graph", "endpoint", endpoint.URL, "arch", arch, "channel", channel, "version", version, "err", err)
+		client.Metrics.UpstreamValidationFailures.WithLabelValues(client.Name, endpoint.URL).Inc()
+		return nil, invalidResponseError(err)
+	}
+
+	// the cluster version operator ignores conditional updates to releases missing in the graph, so the graph is
+	// still usable without them
+	if dangling := g.RemoveDanglingUpdates(); len(dangling) > 0 {
+		client.Logger.Warnw("removed conditional updates to unknown versions", "endpoint", endpoint.URL, "arch", arch, "channel", channel, "version", version, "updates", dangling)
+		client.Metrics.UpstreamValidationWarnings.WithLabelValues(client.Name, endpoint.URL).Add(float64(len(dangling)))
+
+		response.Body, err = g.Marshal()
+		if err != nil {
+			return nil, invalidResponseError(err)
+		}
 	}
 
-	elapsed := time.Until(startTime)
-	client.Metrics.UpstreamResponseTime.WithLabelValues(arch, channel, version).Observe(float64(elapsed.Microseconds()))
-	return body, nil
+	client.observeResponseTime(arch, channel, version, startTime)
+	return response, nil
+}
+
+func (client *UpstreamClient) observeResponseTime(arch, channel, version string, startTime time.Time) {
+	elapsed := time.Since(startTime)
+	client.Metrics.UpstreamResponseTime.WithLabelValues(client.Name, arch, channel, version).Observe(float64(elapsed.Microseconds()))
 }
 
-func (client *UpstreamClient) buildURL(arch, channel, version string) (string, error) {
-	finalUrl, err := url.Parse(client.Endpoint)
+func buildURL(endpoint, arch, channel, version string) (string, error) {
+	finalUrl, err := url.Parse(endpoint)
 	if err != nil {
-		client.Logger.Debugw("cannot parse upstream url", "err", err, "url", client.Endpoint)
 		return "", err
 	}
 
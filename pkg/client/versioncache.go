@@ -4,44 +4,136 @@ import (
 	"github.com/lukeelten/openshift-update-proxy/pkg/utils"
 	"go.uber.org/zap"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	EVICTION_REASON_IDLE    = "idle"
+	EVICTION_REASON_ENTRIES = "entries"
+	EVICTION_REASON_BYTES   = "bytes"
+
+	// STALE_REASON_ERROR marks expired entries served because the upstream is failing
+	STALE_REASON_ERROR = "error"
+	// STALE_REASON_REVALIDATE marks expired entries served while they are refreshed in the background
+	STALE_REASON_REVALIDATE = "revalidate"
+)
+
 type VersionEntry struct {
-	Arch    string
-	Channel string
-	Version string
+	Arch    string `json:"arch"`
+	Channel string `json:"channel"`
+	Version string `json:"version"`
 
-	Body []byte
+	Body []byte `json:"body,omitempty"`
+	// BodyHash identifies the body. Entries with identical bodies share the same body in the cache.
+	BodyHash string `json:"bodyHash,omitempty"`
 
-	LastAccessed time.Time
-	ValidUntil   time.Time
+	// Validators returned by the upstream, used for conditional requests
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	// Endpoint of the upstream which served the entry
+	Endpoint string `json:"endpoint,omitempty"`
+
+	LastAccessed time.Time `json:"lastAccessed"`
+	AccessCount  uint64    `json:"accessCount"`
+	ValidUntil   time.Time `json:"validUntil"`
+
+	// StaleReason is set by OpenShiftVersionClient.Load if an expired entry is served
+	StaleReason string `json:"-"`
 }
 
 type ForeachFunc func(entry VersionEntry)
 
+// EvictionFunc is called for every entry the cache evicts on its own to stay within its limits.
+// It is called while the cache is locked and must not call back into the cache.
+type EvictionFunc func(entry VersionEntry, reason string)
+
+// cacheItem holds an entry together with its access statistics. The statistics are updated atomically,
+// so reads only need the read lock. The entry itself is only replaced under the write lock.
+type cacheItem struct {
+	entry VersionEntry
+
+	lastAccessed atomic.Int64
+	accessCount  atomic.Uint64
+}
+
+func newCacheItem(entry VersionEntry) *cacheItem {
+	item := &cacheItem{entry: entry}
+	item.lastAccessed.Store(entry.LastAccessed.UnixNano())
+	item.accessCount.Store(entry.AccessCount)
+	return item
+}
+
+func (item *cacheItem) access() {
+	item.lastAccessed.Store(time.Now().UnixNano())
+	item.accessCount.Add(1)
+}
+
+// snapshot returns a copy of the entry including the current access statistics
+func (item *cacheItem) snapshot() VersionEntry {
+	entry := item.entry
+	entry.LastAccessed = time.Unix(0, item.lastAccessed.Load())
+	entry.AccessCount = item.accessCount.Load()
+	return entry
+}
+
+// blob is a body shared by all entries with the same content
+type blob struct {
+	body []byte
+	refs int
+}
+
+// OpenShiftVersionCache is the in-memory implementation of CacheStore.
+// Bodies are stored once per content hash, so entries with identical bodies share the memory.
+// If limits are set, the least recently used entries are evicted once the number of entries or the total size of
+// all bodies exceeds them.
 type OpenShiftVersionCache struct {
 	Logger          *zap.SugaredLogger
 	defaultLifetime time.Duration
+	maxEntries      int
+	maxBytes        int64
+	onEvict         EvictionFunc
+
+	// called when the last entry referencing a body has been removed
+	onBlobRemoved func(hash string)
 
 	lock  sync.RWMutex
-	cache map[string]VersionEntry
+	cache map[string]*cacheItem
+	blobs map[string]*blob
+	bytes int64
 }
 
-func NewOpenShiftVersionCache(defaultLifetime time.Duration, logger *zap.SugaredLogger) *OpenShiftVersionCache {
+var _ CacheStore = &OpenShiftVersionCache{}
+
+// NewOpenShiftVersionCache creates a new cache. A limit of 0 disables the respective limit. onEvict may be nil.
+func NewOpenShiftVersionCache(defaultLifetime time.Duration, maxEntries int, maxBytes int64, onEvict EvictionFunc, logger *zap.SugaredLogger) *OpenShiftVersionCache {
 	return &OpenShiftVersionCache{
 		Logger:          logger,
 		defaultLifetime: defaultLifetime,
+		maxEntries:      maxEntries,
+		maxBytes:        maxBytes,
+		onEvict:         onEvict,
 
 		lock:  sync.RWMutex{},
-		cache: make(map[string]VersionEntry),
+		cache: make(map[string]*cacheItem),
+		blobs: make(map[string]*blob),
 	}
 }
 
 func (cache *OpenShiftVersionCache) Size() float64 {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+
 	return float64(len(cache.cache))
 }
 
+func (cache *OpenShiftVersionCache) Bytes() float64 {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+
+	return float64(cache.bytes)
+}
+
 func (cache *OpenShiftVersionCache) HasKey(arch, channel, version string) bool {
 	key := utils.MakeKey(arch, channel, version)
 
@@ -52,38 +144,35 @@ func (cache *OpenShiftVersionCache) HasKey(arch, channel, version string) bool {
 	return hasKey
 }
 
-func (cache *OpenShiftVersionCache) Get(arch, channel, version string) ([]byte, error) {
+func (cache *OpenShiftVersionCache) Get(arch, channel, version string) (VersionEntry, error) {
+	return cache.load(arch, channel, version, true)
+}
+
+func (cache *OpenShiftVersionCache) Peek(arch, channel, version string) (VersionEntry, error) {
+	return cache.load(arch, channel, version, false)
+}
+
+func (cache *OpenShiftVersionCache) load(arch, channel, version string, recordAccess bool) (VersionEntry, error) {
 	key := utils.MakeKey(arch, channel, version)
 	cache.Logger.Debugw("load cache entry", "key", key)
 
 	cache.lock.RLock()
 	defer cache.lock.RUnlock()
 
-	entry, ok := cache.cache[key]
-	if ok {
-		entry.LastAccessed = time.Now()
-		return entry.Body, nil
+	item, ok := cache.cache[key]
+	if !ok {
+		return VersionEntry{}, utils.ERR_NOT_FOUND
 	}
 
-	return []byte{}, utils.ERR_NOT_FOUND
-}
-
-func (cache *OpenShiftVersionCache) Set(arch, channel, version string, body []byte) {
-	entry := VersionEntry{
-		Arch:         arch,
-		Channel:      channel,
-		Version:      version,
-		Body:         body,
-		LastAccessed: time.Now(),
-		ValidUntil:   time.Now().Add(cache.defaultLifetime),
+	if recordAccess {
+		item.access()
 	}
 
-	key := utils.MakeKey(entry.Arch, entry.Channel, entry.Version)
-
-	cache.lock.Lock()
-	defer cache.lock.Unlock()
+	return item.snapshot(), nil
+}
 
-	cache.cache[key] = entry
+func (cache *OpenShiftVersionCache) Set(entry VersionEntry, lifetime time.Duration) {
+	cache.put(cache.newEntry(entry, lifetime))
 }
 
 func (cache *OpenShiftVersionCache) Delete(arch, channel, version string) {
@@ -91,7 +180,7 @@ func (cache *OpenShiftVersionCache) Delete(arch, channel, version string) {
 	cache.lock.Lock()
 	defer cache.lock.Unlock()
 
-	delete(cache.cache, key)
+	cache.remove(key)
 }
 
 func (cache *OpenShiftVersionCache) Foreach(foreachFunc ForeachFunc) {
@@ -102,21 +191,137 @@ func (cache *OpenShiftVersionCache) Foreach(foreachFunc ForeachFunc) {
 	}
 }
 
+// Flush does nothing, as the cache is not persisted
+func (cache *OpenShiftVersionCache) Flush() {}
+
+func (cache *OpenShiftVersionCache) newEntry(entry VersionEntry, lifetime time.Duration) VersionEntry {
+	if lifetime < 0 {
+		lifetime = cache.defaultLifetime
+	}
+
+	entry.LastAccessed = time.Now()
+	entry.AccessCount = 0
+	entry.ValidUntil = time.Now().Add(lifetime)
+	return entry
+}
+
+// put stores the entry and returns the stored version. If the key already exists, the access statistics
+// of the existing entry are kept, so refreshing an entry does not count as access.
+func (cache *OpenShiftVersionCache) put(entry VersionEntry) VersionEntry {
+	key := utils.MakeKey(entry.Arch, entry.Channel, entry.Version)
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	entry.BodyHash = utils.ContentHash(entry.Body)
+	entry.Body = cache.acquireBlob(entry.BodyHash, entry.Body)
+
+	item, ok := cache.cache[key]
+	if ok {
+		cache.releaseBlob(item.entry.BodyHash)
+		item.entry = entry
+	} else {
+		item = newCacheItem(entry)
+		cache.cache[key] = item
+	}
+
+	cache.evict(item)
+	return item.snapshot()
+}
+
+// evict removes entries until the cache is within its limits. The given entry is never evicted,
+// so an entry is always available right after it has been set.
+// Must be called with the write lock held.
+func (cache *OpenShiftVersionCache) evict(keep *cacheItem) {
+	for len(cache.cache) > 1 {
+		reason := ""
+		if cache.maxEntries > 0 && len(cache.cache) > cache.maxEntries {
+			reason = EVICTION_REASON_ENTRIES
+		} else if cache.maxBytes > 0 && cache.bytes > cache.maxBytes {
+			reason = EVICTION_REASON_BYTES
+		} else {
+			return
+		}
+
+		key, item := cache.victim(keep)
+		cache.remove(key)
+
+		entry := item.snapshot()
+		cache.Logger.Debugw("evicted entry from cache", "arch", entry.Arch, "channel", entry.Channel, "version", entry.Version, "accessCount", entry.AccessCount, "reason", reason)
+		if cache.onEvict != nil {
+			cache.onEvict(entry, reason)
+		}
+	}
+}
+
+// victim selects the least recently used entry except keep
+func (cache *OpenShiftVersionCache) victim(keep *cacheItem) (string, *cacheItem) {
+	var victimKey string
+	var victim *cacheItem
+
+	for key, item := range cache.cache {
+		if item == keep {
+			continue
+		}
+
+		if victim == nil || item.lastAccessed.Load() < victim.lastAccessed.Load() {
+			victimKey, victim = key, item
+		}
+	}
+
+	return victimKey, victim
+}
+
+func (cache *OpenShiftVersionCache) remove(key string) {
+	item, ok := cache.cache[key]
+	if ok {
+		delete(cache.cache, key)
+		cache.releaseBlob(item.entry.BodyHash)
+	}
+}
+
+// acquireBlob returns the shared body for the hash and increases its reference count.
+// Must be called with the write lock held.
+func (cache *OpenShiftVersionCache) acquireBlob(hash string, body []byte) []byte {
+	b, ok := cache.blobs[hash]
+	if !ok {
+		b = &blob{body: body}
+		cache.blobs[hash] = b
+		cache.bytes += int64(len(body))
+	}
+
+	b.refs++
+	return b.body
+}
+
+// releaseBlob decreases the reference count of a body and removes it once it is no longer referenced.
+// Must be called with the write lock held.
+func (cache *OpenShiftVersionCache) releaseBlob(hash string) {
+	b, ok := cache.blobs[hash]
+	if !ok {
+		return
+	}
+
+	b.refs--
+	if b.refs <= 0 {
+		delete(cache.blobs, hash)
+		cache.bytes -= int64(len(b.body))
+		if cache.onBlobRemoved != nil {
+			cache.onBlobRemoved(hash)
+		}
+	}
+}
+
 func (cache *OpenShiftVersionCache) lightCopy() map[string]VersionEntry {
 	cache.lock.RLock()
 	defer cache.lock.RUnlock()
 
 	c := make(map[string]VersionEntry, len(cache.cache))
 
-	for key, entry := range cache.cache {
-		c[key] = VersionEntry{
-			Arch:         entry.Arch,
-			Channel:      entry.Channel,
-			Version:      entry.Version,
-			Body:         nil,
-			LastAccessed: entry.LastAccessed,
-			ValidUntil:   entry.ValidUntil,
-		}
+	for key, item := range cache.cache {
+		entry := item.snapshot()
+		entry.Body = nil
+		c[key] = entry
 	}
 
 	return c
@@ -0,0 +1,175 @@
+package client_test
+
+import (
+	"github.com/lukeelten/openshift-update-proxy/pkg/client"
+	"github.com/lukeelten/openshift-update-proxy/pkg/utils"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type eviction struct {
+	version string
+	reason  string
+}
+
+// evictionRecorder records evictions in the order they happen
+type evictionRecorder struct {
+	evictions []eviction
+}
+
+func (recorder *evictionRecorder) onEvict(entry client.VersionEntry, reason string) {
+	recorder.evictions = append(recorder.evictions, eviction{version: entry.Version, reason: reason})
+}
+
+// step runs an operation on the cache. Steps are separated by a short sleep, so access times are distinct.
+type step struct {
+	set  string
+	body string
+	get  string
+}
+
+func TestCacheEviction(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxEntries int
+		maxBytes   int64
+		steps      []step
+		evictions  []eviction
+		remaining  []string
+	}{
+		{
+			name:      "no limits",
+			steps:     []step{{set: "4.14.1", body: "aaaa"}, {set: "4.14.2", body: "bbbb"}, {set: "4.14.3", body: "cccc"}},
+			evictions: nil,
+			remaining: []string{"4.14.1", "4.14.2", "4.14.3"},
+		},
+		{
+			name:       "max entries evicts least recently set",
+			maxEntries: 2,
+			steps:      []step{{set: "4.14.1", body: "aaaa"}, {set: "4.14.2", body: "bbbb"}, {set: "4.14.3", body: "cccc"}},
+			evictions:  []eviction{{version: "4.14.1", reason: client.EVICTION_REASON_ENTRIES}},
+			remaining:  []string{"4.14.2", "4.14.3"},
+		},
+		{
+			name:       "max entries evicts least recently used",
+			maxEntries: 2,
+			steps:      []step{{set: "4.14.1", body: "aaaa"}, {set: "4.14.2", body: "bbbb"}, {get: "4.14.1"}, {set: "4.14.3", body: "cccc"}},
+			evictions:  []eviction{{version: "4.14.2", reason: client.EVICTION_REASON_ENTRIES}},
+			remaining:  []string{"4.14.1", "4.14.3"},
+		},
+		{
+			name:       "recency wins over access count",
+			maxEntries: 3,
+			steps: []step{
+				{set: "4.14.1", body: "aaaa"}, {get: "4.14.1"}, {get: "4.14.1"},
+				{set: "4.14.2", body: "bbbb"}, {set: "4.14.3", body: "cccc"}, {get: "4.14.2"}, {get: "4.14.3"},
+				{set: "4.14.4", body: "dddd"},
+			},
+			evictions: []eviction{{version: "4.14.1", reason: client.EVICTION_REASON_ENTRIES}},
+			remaining: []string{"4.14.2", "4.14.3", "4.14.4"},
+		},
+		{
+			name:      "max bytes",
+			maxBytes:  10,
+			steps:     []step{{set: "4.14.1", body: "aaaa"}, {set: "4.14.2", body: "bbbb"}, {set: "4.14.3", body: "cccc"}},
+			evictions: []eviction{{version: "4.14.1", reason: client.EVICTION_REASON_BYTES}},
+			remaining: []string{"4.14.2", "4.14.3"},
+		},
+		{
+			name:      "max bytes counts shared bodies once",
+			maxBytes:  10,
+			steps:     []step{{set: "4.14.1", body: "aaaa"}, {set: "4.14.2", body: "aaaa"}, {set: "4.14.3", body: "cccc"}},
+			evictions: nil,
+			remaining: []string{"4.14.1", "4.14.2", "4.14.3"},
+		},
+		{
+			name:      "max bytes evicts until within limit",
+			maxBytes:  10,
+			steps:     []step{{set: "4.14.1", body: "aaaa"}, {set: "4.14.2", body: "bbbb"}, {set: "4.14.3", body: "cccccccc"}},
+			evictions: []eviction{{version: "4.14.1", reason: client.EVICTION_REASON_BYTES}, {version: "4.14.2", reason: client.EVICTION_REASON_BYTES}},
+			remaining: []string{"4.14.3"},
+		},
+		{
+			name:      "entry larger than limit is kept",
+			maxBytes:  2,
+			steps:     []step{{set: "4.14.1", body: "aaaa"}},
+			evictions: nil,
+			remaining: []string{"4.14.1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := &evictionRecorder{}
+			cache := client.NewOpenShiftVersionCache(time.Hour, test.maxEntries, test.maxBytes, recorder.onEvict, zap.NewNop().Sugar())
+
+			for _, step := range test.steps {
+				if len(step.set) > 0 {
+					cache.Set(client.VersionEntry{Arch: "amd64", Channel: "stable-4.14", Version: step.set, Body: []byte(step.body)}, client.DEFAULT_LIFETIME)
+				} else if _, err := cache.Get("amd64", "stable-4.14", step.get); err != nil {
+					t.Fatalf("cannot get %s: %v", step.get, err)
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			if !reflect.DeepEqual(recorder.evictions, test.evictions) {
+				t.Errorf("expected evictions %v, got %v", test.evictions, recorder.evictions)
+			}
+
+			remaining := make([]string, 0)
+			for _, version := range []string{"4.14.1", "4.14.2", "4.14.3", "4.14.4"} {
+				if cache.HasKey("amd64", "stable-4.14", version) {
+					remaining = append(remaining, version)
+				}
+			}
+			if !reflect.DeepEqual(remaining, test.remaining) {
+				t.Errorf("expected remaining entries %v, got %v", test.remaining, remaining)
+			}
+		})
+	}
+}
+
+func TestFileVersionCacheEviction(t *testing.T) {
+	directory := t.TempDir()
+	recorder := &evictionRecorder{}
+	store, err := client.NewFileVersionCache(time.Hour, 2, 0, recorder.onEvict, directory, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Set(client.VersionEntry{Arch: "amd64", Channel: "stable-4.14", Version: "4.14.1", Body: []byte("old")}, client.DEFAULT_LIFETIME)
+	time.Sleep(time.Millisecond)
+	store.Set(client.VersionEntry{Arch: "amd64", Channel: "stable-4.14", Version: "4.14.2", Body: []byte("shared")}, client.DEFAULT_LIFETIME)
+	time.Sleep(time.Millisecond)
+	store.Set(client.VersionEntry{Arch: "amd64", Channel: "stable-4.14", Version: "4.14.3", Body: []byte("shared")}, client.DEFAULT_LIFETIME)
+
+	if !reflect.DeepEqual(recorder.evictions, []eviction{{version: "4.14.1", reason: client.EVICTION_REASON_ENTRIES}}) {
+		t.Errorf("unexpected evictions %v", recorder.evictions)
+	}
+
+	evictedFile := filepath.Join(directory, utils.MakeKey("amd64", "stable-4.14", "4.14.1")+".json")
+	if _, err := os.Stat(evictedFile); !os.IsNotExist(err) {
+		t.Errorf("entry file of evicted entry not removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(directory, "blobs", utils.ContentHash([]byte("old")))); !os.IsNotExist(err) {
+		t.Errorf("blob of evicted entry not removed: %v", err)
+	}
+	if blobs := countFiles(t, filepath.Join(directory, "blobs", "*")); blobs != 1 {
+		t.Errorf("expected only the shared blob, got %d blobs", blobs)
+	}
+
+	// evicting one of the entries sharing a body keeps the body
+	time.Sleep(time.Millisecond)
+	store.Set(client.VersionEntry{Arch: "amd64", Channel: "stable-4.14", Version: "4.14.4", Body: []byte("new")}, client.DEFAULT_LIFETIME)
+	if _, err := os.Stat(filepath.Join(directory, "blobs", utils.ContentHash([]byte("shared")))); err != nil {
+		t.Errorf("shared blob removed while still referenced: %v", err)
+	}
+
+	if reopened := openFileVersionCache(t, directory); reopened.Size() != 2 {
+		t.Errorf("expected 2 entries after restart, got %v", reopened.Size())
+	}
+}
@@ -2,12 +2,29 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
 	"log"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 )
 
-const DEFAULT_CONFIG_FILE_NAME = "config.yaml"
+const (
+	DEFAULT_CONFIG_FILE_NAME  = "config.yaml"
+	DEFAULT_UPSTREAM_TIMEOUT  = 10 * time.Second
+	DEFAULT_FAILOVER_COOLDOWN = time.Minute
+	DEFAULT_RETRY_ATTEMPTS    = 3
+	DEFAULT_INITIAL_BACKOFF   = 500 * time.Millisecond
+	DEFAULT_MAX_BACKOFF       = 10 * time.Second
+	DEFAULT_RETRY_DEADLINE    = 30 * time.Second
+	DEFAULT_FAILURE_THRESHOLD = 5
+	DEFAULT_OPEN_DURATION     = 30 * time.Second
+)
+
+// upstreamNamePattern restricts upstream names, as they are used in file names of the cache and the policy state
+var upstreamNamePattern = regexp.MustCompile(`^[a-z0-9-]+$`)
 
 func LoadConfig() *UpdateProxyConfig {
 	configFile := configFileName()
@@ -37,9 +54,97 @@ func LoadConfig() *UpdateProxyConfig {
 		log.Fatal(err)
 	}
 
+	err = config.initUpstreams()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	return &config
 }
 
+// initUpstreams converts the legacy OKD and OCP blocks into upstreams if no upstreams are configured,
+// applies defaults and validates the upstream list.
+func (config *UpdateProxyConfig) initUpstreams() error {
+	if len(config.Upstreams) == 0 {
+		config.Upstreams = []UpstreamConfig{
+			{
+				Name:     "okd",
+				Path:     config.OKD.Path,
+				Endpoint: config.OKD.Endpoint,
+				Insecure: config.OKD.Insecure,
+				Timeout:  config.OKD.Timeout,
+			},
+			{
+				Name:     "ocp",
+				Path:     config.OCP.Path,
+				Endpoint: config.OCP.Endpoint,
+				Insecure: config.OCP.Insecure,
+				Timeout:  config.OCP.Timeout,
+			},
+		}
+	}
+
+	names := make(map[string]bool, len(config.Upstreams))
+	paths := make(map[string]bool, len(config.Upstreams))
+
+	for i := range config.Upstreams {
+		upstream := &config.Upstreams[i]
+
+		if len(upstream.Name) == 0 {
+			return fmt.Errorf("upstream %d has no name", i)
+		}
+		if !upstreamNamePattern.MatchString(upstream.Name) {
+			return fmt.Errorf("upstream %q: name may only contain lowercase letters, digits and dashes", upstream.Name)
+		}
+		if len(upstream.Endpoint) > 0 {
+			upstream.Endpoints = append([]string{upstream.Endpoint}, upstream.Endpoints...)
+			upstream.Endpoint = ""
+		}
+		if len(upstream.Endpoints) == 0 {
+			return fmt.Errorf("upstream %s has no endpoint", upstream.Name)
+		}
+		if upstream.FailoverCooldown <= 0 {
+			upstream.FailoverCooldown = DEFAULT_FAILOVER_COOLDOWN
+		}
+		if len(upstream.Path) == 0 {
+			upstream.Path = "/" + upstream.Name
+		}
+		if !strings.HasPrefix(upstream.Path, "/") {
+			return fmt.Errorf("upstream %s: path %s must start with /", upstream.Name, upstream.Path)
+		}
+		if config.Health.Enabled && upstream.Path == config.Health.Path {
+			return fmt.Errorf("upstream %s: path %s is used by the health check", upstream.Name, upstream.Path)
+		}
+		if upstream.Timeout <= 0 {
+			upstream.Timeout = DEFAULT_UPSTREAM_TIMEOUT
+		}
+		upstream.Retry.setDefaults(upstream.Timeout)
+		if upstream.CircuitBreaker.FailureThreshold <= 0 {
+			upstream.CircuitBreaker.FailureThreshold = DEFAULT_FAILURE_THRESHOLD
+		}
+		if upstream.CircuitBreaker.OpenDuration <= 0 {
+			upstream.CircuitBreaker.OpenDuration = DEFAULT_OPEN_DURATION
+		}
+		if (len(upstream.TLS.ClientCertFile) > 0) != (len(upstream.TLS.ClientKeyFile) > 0) {
+			return fmt.Errorf("upstream %s needs both clientCertFile and clientKeyFile", upstream.Name)
+		}
+		if len(upstream.Auth.BearerTokenFile) > 0 && len(upstream.Auth.Username) > 0 {
+			return fmt.Errorf("upstream %s cannot use bearer token and basic auth at the same time", upstream.Name)
+		}
+
+		if names[upstream.Name] {
+			return fmt.Errorf("duplicate upstream name %s", upstream.Name)
+		}
+		if paths[upstream.Path] {
+			return fmt.Errorf("duplicate upstream path %s", upstream.Path)
+		}
+		names[upstream.Name] = true
+		paths[upstream.Path] = true
+	}
+
+	return nil
+}
+
 func configFileName() string {
 	configFile := flag.String("config-file", "", "Name or path of configuration file")
 	flag.Parse()
@@ -51,3 +156,21 @@ func configFileName() string {
 
 	return *configFile
 }
+
+func (retry *RetryConfig) setDefaults(timeout time.Duration) {
+	if retry.MaxAttempts <= 0 {
+		retry.MaxAttempts = DEFAULT_RETRY_ATTEMPTS
+	}
+	if retry.InitialBackoff <= 0 {
+		retry.InitialBackoff = DEFAULT_INITIAL_BACKOFF
+	}
+	if retry.MaxBackoff <= 0 {
+		retry.MaxBackoff = DEFAULT_MAX_BACKOFF
+	}
+	if retry.Deadline <= 0 {
+		retry.Deadline = DEFAULT_RETRY_DEADLINE
+		if timeout > retry.Deadline {
+			retry.Deadline = timeout
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestInitUpstreams(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream UpstreamConfig
+		valid    bool
+	}{
+		{name: "default path", upstream: UpstreamConfig{Name: "ocp-4"}, valid: true},
+		{name: "custom path", upstream: UpstreamConfig{Name: "ocp", Path: "/api/graph"}, valid: true},
+		{name: "path without slash", upstream: UpstreamConfig{Name: "ocp", Path: "graph"}},
+		{name: "health check path", upstream: UpstreamConfig{Name: "ocp", Path: "/health"}},
+		{name: "name with path separator", upstream: UpstreamConfig{Name: "../escaped"}},
+		{name: "uppercase name", upstream: UpstreamConfig{Name: "OCP"}},
+		{name: "name with dot", upstream: UpstreamConfig{Name: "ocp.stable"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &UpdateProxyConfig{}
+			config.Health.Enabled = true
+			config.Health.Path = "/health"
+			test.upstream.Endpoint = "https://example.com/graph"
+			config.Upstreams = []UpstreamConfig{test.upstream}
+
+			err := config.initUpstreams()
+			if test.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestInitUpstreamsHealthDisabled(t *testing.T) {
+	config := &UpdateProxyConfig{}
+	config.Health.Path = "/health"
+	config.Upstreams = []UpstreamConfig{{Name: "ocp", Path: "/health", Endpoint: "https://example.com/graph"}}
+
+	if err := config.initUpstreams(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
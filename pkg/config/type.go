@@ -7,6 +7,10 @@ type UpdateProxyConfig struct {
 
 	Listen string `yaml:"listen" env:"HTTP_LISTEN" env-default:"0.0.0.0:8080"`
 
+	// Upstreams lists all upstream graph endpoints. If empty, the legacy OKD and OCP blocks are used.
+	Upstreams []UpstreamConfig `yaml:"upstreams"`
+
+	// Deprecated: use Upstreams
 	OKD struct {
 		Path     string        `yaml:"path" env-default:"/okd"`
 		Endpoint string        `yaml:"endpoint" env:"OKD_ENDPOINT" env-default:"https://amd64.origin.releases.ci.openshift.org/graph"`
@@ -14,6 +18,7 @@ type UpdateProxyConfig struct {
 		Timeout  time.Duration `yaml:"timeout" env-default:"10s"`
 	} `yaml:"okd"`
 
+	// Deprecated: use Upstreams
 	OCP struct {
 		Path     string        `yaml:"path" env-default:"/ocp"`
 		Endpoint string        `yaml:"endpoint" env:"OPENSHIFT_ENDPOINT" env-default:"https://api.openshift.com/api/upgrades_info/v1/graph"`
@@ -23,8 +28,32 @@ type UpdateProxyConfig struct {
 
 	Cache struct {
 		DefaultLifetime time.Duration `yaml:"defaultLifetime" env:"CACHE_DEFAULT_TTL" env-default:"8h"`
-		EvictAfter      time.Duration `yaml:"evictAfter" env:"CACHE_EVICT_AFTER" env-default:"168h"`
+		// MinLifetime and MaxLifetime bound the lifetime announced by the upstream with Cache-Control or Expires headers
+		MinLifetime time.Duration `yaml:"minLifetime" env:"CACHE_MIN_TTL" env-default:"5m"`
+		MaxLifetime time.Duration `yaml:"maxLifetime" env:"CACHE_MAX_TTL" env-default:"24h"`
+		EvictAfter  time.Duration `yaml:"evictAfter" env:"CACHE_EVICT_AFTER" env-default:"168h"`
+		// StaleIfError is the grace period in which expired entries are still served if the upstream is unreachable
+		StaleIfError    time.Duration `yaml:"staleIfError" env:"CACHE_STALE_IF_ERROR" env-default:"168h"`
 		ControllerCycle time.Duration `yaml:"controllerCycle" env-default:"5m"`
+		// RefreshWorkers is the number of entries refreshed in parallel per upstream
+		RefreshWorkers int `yaml:"refreshWorkers" env:"CACHE_REFRESH_WORKERS" env-default:"4"`
+		// RefreshDeadline bounds the duration of a refresh cycle, defaults to ControllerCycle
+		RefreshDeadline time.Duration `yaml:"refreshDeadline" env:"CACHE_REFRESH_DEADLINE" env-default:"0"`
+		// LifetimeJitter shortens the lifetime of each entry by a random fraction up to the given value,
+		// so entries loaded at the same time do not expire at the same time
+		LifetimeJitter float64 `yaml:"lifetimeJitter" env:"CACHE_LIFETIME_JITTER" env-default:"0.1"`
+		// MaxEntries and MaxBytes limit the size of the cache per upstream, 0 disables the limit
+		MaxEntries int   `yaml:"maxEntries" env:"CACHE_MAX_ENTRIES" env-default:"0"`
+		MaxBytes   int64 `yaml:"maxBytes" env:"CACHE_MAX_BYTES" env-default:"0"`
+		// Directory persists the cache including access statistics, which are written every controller cycle
+		// and on shutdown
+		Directory string `yaml:"directory" env:"CACHE_DIRECTORY" env-default:""`
+		// Store selects the cache backend: "memory" or "file". Defaults to "file" if a directory is set.
+		Store string `yaml:"store" env:"CACHE_STORE" env-default:""`
+		// ShareAcrossVersions reuses upstream responses across versions of a channel once the upstream has been
+		// observed to return identical graphs for different versions. Only enable it for upstreams which never
+		// return version specific graphs, as two identical responses may be a coincidence.
+		ShareAcrossVersions bool `yaml:"shareAcrossVersions" env:"CACHE_SHARE_ACROSS_VERSIONS" env-default:"false"`
 	} `yaml:"cache"`
 
 	Metrics struct {
@@ -36,4 +65,108 @@ type UpdateProxyConfig struct {
 		Enabled bool   `yaml:"enabled" env:"HEALTH_ENABLED" env-default:"true"`
 		Path    string `yaml:"path" env-default:"/health"`
 	} `yaml:"health"`
+
+	// Admin serves the API to change policies at runtime on a separate listener
+	Admin struct {
+		Enabled bool   `yaml:"enabled" env:"ADMIN_ENABLED" env-default:"false"`
+		Listen  string `yaml:"listen" env:"ADMIN_LISTEN" env-default:"127.0.0.1:8081"`
+		// TokenFile contains a bearer token required for all admin requests. Without token, the API is unauthenticated.
+		TokenFile string `yaml:"tokenFile" env:"ADMIN_TOKEN_FILE" env-default:""`
+	} `yaml:"admin"`
+
+	// StateDirectory stores policy changes made at runtime. Required by the admin API, soak periods and approvals.
+	StateDirectory string `yaml:"stateDirectory" env:"STATE_DIRECTORY" env-default:""`
+}
+
+type UpstreamConfig struct {
+	// Name identifies the upstream in metrics, logs and the cache directory. Only lowercase letters, digits and
+	// dashes are allowed.
+	Name string `yaml:"name"`
+	// Path the upstream is served on, defaults to /<name>. Must start with / and differ from the health check path.
+	Path string `yaml:"path"`
+	// Endpoint is a shorthand for a single endpoint. If both are given, Endpoint is tried first.
+	Endpoint string `yaml:"endpoint"`
+	// Endpoints are tried in the given order until one returns a valid response
+	Endpoints []string `yaml:"endpoints"`
+	// FailoverCooldown is the time a failed endpoint is skipped, defaults to 1m
+	FailoverCooldown time.Duration `yaml:"failoverCooldown"`
+	Insecure         bool          `yaml:"insecure"`
+	// Timeout of a single request to an endpoint
+	Timeout time.Duration `yaml:"timeout"`
+
+	Retry          RetryConfig          `yaml:"retry"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuitBreaker"`
+	// Proxy configures an outbound HTTP(S) proxy. If not set, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are used.
+	Proxy ProxyConfig `yaml:"proxy"`
+	TLS   TLSConfig   `yaml:"tls"`
+	Auth  AuthConfig  `yaml:"auth"`
+	// Headers are added to every request to the upstream
+	Headers map[string]string `yaml:"headers"`
+
+	Policy PolicyConfig `yaml:"policy"`
+}
+
+// PolicyConfig configures how the graphs of an upstream are rewritten before they are served
+type PolicyConfig struct {
+	// Blocklist lists versions or version ranges (e.g. 4.14.3, >=4.14.0 <4.14.5, 4.13.x) which are removed
+	Blocklist []string `yaml:"blocklist"`
+	// SoakPeriod hides updates to a release until it has been in the graph of a channel for the given duration.
+	// The period starts when the release first appears in the channel for any architecture. Requires StateDirectory.
+	SoakPeriod time.Duration `yaml:"soakPeriod"`
+	// RequireApproval removes releases which appear in a channel from served graphs until they are approved
+	// through the admin API. Requires StateDirectory.
+	RequireApproval bool `yaml:"requireApproval"`
+	// Channels configures version pins per channel. Pins set through the admin API take precedence.
+	Channels map[string]ChannelPolicyConfig `yaml:"channels"`
+}
+
+type ChannelPolicyConfig struct {
+	// MinVersion and MaxVersion bound the versions served in the channel. Partial versions like 4.14 include
+	// all z-stream releases.
+	MinVersion string `yaml:"minVersion"`
+	MaxVersion string `yaml:"maxVersion"`
+}
+
+// AuthConfig configures the authentication against the upstream. Bearer token and basic auth are exclusive.
+type AuthConfig struct {
+	// BearerTokenFile contains the token sent as Authorization header, the file is re-read when it changes
+	BearerTokenFile string `yaml:"bearerTokenFile"`
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password"`
+}
+
+// TLSConfig configures the connection to the upstream endpoints. Files are reloaded when they change.
+type TLSConfig struct {
+	// CAFile contains PEM encoded certificates which are trusted in addition to the system roots
+	CAFile         string `yaml:"caFile"`
+	ClientCertFile string `yaml:"clientCertFile"`
+	ClientKeyFile  string `yaml:"clientKeyFile"`
+	// MinVersion is one of 1.0, 1.1, 1.2 or 1.3. Defaults to 1.2.
+	MinVersion string `yaml:"minVersion"`
+	// ServerName overrides the name used for SNI and certificate verification
+	ServerName string `yaml:"serverName"`
+}
+
+type ProxyConfig struct {
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// NoProxy lists hosts, domains, IPs and CIDR ranges which are connected directly
+	NoProxy []string `yaml:"noProxy"`
+}
+
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed requests which open the circuit. Defaults to 5.
+	FailureThreshold int `yaml:"failureThreshold"`
+	// OpenDuration is the time after which an open circuit lets a probe request through. Defaults to 30s.
+	OpenDuration time.Duration `yaml:"openDuration"`
+}
+
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts including the first one, 1 disables retries. Defaults to 3.
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+	// Deadline bounds the time spent on all attempts of a request
+	Deadline time.Duration `yaml:"deadline"`
 }
@@ -0,0 +1,76 @@
+package graph
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// unmarshalWithExtra decodes data into value and collects all fields except the known ones into extra.
+// Extra fields are stored normalized, exactly as they are written by marshalWithExtra.
+// value must not implement json.Unmarshaler itself, otherwise the call recurses.
+func unmarshalWithExtra(data []byte, value interface{}, extra *map[string]json.RawMessage, known ...string) error {
+	err := json.Unmarshal(data, value)
+	if err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return err
+	}
+
+	// encoding/json matches field names case-insensitively, so do the same to not keep a field twice
+	for name, raw := range fields {
+		if isKnown(name, known) {
+			delete(fields, name)
+			continue
+		}
+
+		// encoding/json compacts and escapes raw messages, so normalize them the same way
+		normalized, err := json.Marshal(raw)
+		if err != nil {
+			return err
+		}
+		fields[name] = normalized
+	}
+
+	if len(fields) == 0 {
+		*extra = nil
+	} else {
+		*extra = fields
+	}
+	return nil
+}
+
+func isKnown(name string, known []string) bool {
+	for _, knownName := range known {
+		if strings.EqualFold(name, knownName) {
+			return true
+		}
+	}
+	return false
+}
+
+// marshalWithExtra encodes value and adds the extra fields. Known fields take precedence over extra fields
+// with the same name.
+func marshalWithExtra(value interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, raw := range extra {
+		if _, ok := fields[name]; !ok {
+			fields[name] = raw
+		}
+	}
+
+	return json.Marshal(fields)
+}
@@ -0,0 +1,142 @@
+package graph
+
+// RemoveNodes removes all nodes for which remove returns true together with all edges and conditional updates
+// from or to them. Edge indices are rewritten, conditional edges without remaining updates are dropped.
+// Returns the versions of the removed nodes.
+func (graph *Graph) RemoveNodes(remove func(node Node) bool) []string {
+	removed := make([]string, 0)
+	removedVersions := make(map[string]bool)
+
+	// maps the old to the new index, -1 for removed nodes
+	indices := make([]int, len(graph.Nodes))
+	nodes := make([]Node, 0, len(graph.Nodes))
+
+	for i, node := range graph.Nodes {
+		if remove(node) {
+			indices[i] = -1
+			removed = append(removed, node.Version)
+			removedVersions[node.Version] = true
+			continue
+		}
+
+		indices[i] = len(nodes)
+		nodes = append(nodes, node)
+	}
+
+	if len(removed) == 0 {
+		return removed
+	}
+
+	graph.Nodes = nodes
+	graph.Edges = graph.reindexEdges(indices)
+	graph.filterConditionalEdges(func(update ConditionalUpdate) bool {
+		return !removedVersions[update.From] && !removedVersions[update.To]
+	})
+
+	return removed
+}
+
+// RemoveDanglingUpdates removes all conditional updates from or to versions which are not nodes of the graph.
+// Conditional edges without remaining updates are dropped. Returns the removed updates.
+func (graph *Graph) RemoveDanglingUpdates() []ConditionalUpdate {
+	versions := make(map[string]bool, len(graph.Nodes))
+	for _, node := range graph.Nodes {
+		versions[node.Version] = true
+	}
+
+	dangling := make([]ConditionalUpdate, 0)
+	for _, conditional := range graph.ConditionalEdges {
+		for _, update := range conditional.Edges {
+			if !versions[update.From] || !versions[update.To] {
+				dangling = append(dangling, update)
+			}
+		}
+	}
+
+	if len(dangling) > 0 {
+		graph.filterConditionalEdges(func(update ConditionalUpdate) bool {
+			return versions[update.From] && versions[update.To]
+		})
+	}
+	return dangling
+}
+
+func (graph *Graph) reindexEdges(indices []int) []Edge {
+	edges := make([]Edge, 0, len(graph.Edges))
+	for _, edge := range graph.Edges {
+		if edge.From < 0 || edge.From >= len(indices) || edge.To < 0 || edge.To >= len(indices) {
+			continue
+		}
+
+		from, to := indices[edge.From], indices[edge.To]
+		if from >= 0 && to >= 0 {
+			edges = append(edges, Edge{From: from, To: to})
+		}
+	}
+	return edges
+}
+
+// filterConditionalEdges keeps the conditional updates for which keep returns true
+func (graph *Graph) filterConditionalEdges(keep func(update ConditionalUpdate) bool) {
+	if graph.ConditionalEdges == nil {
+		return
+	}
+
+	conditionalEdges := make([]ConditionalEdge, 0, len(graph.ConditionalEdges))
+	for _, conditional := range graph.ConditionalEdges {
+		updates := make([]ConditionalUpdate, 0, len(conditional.Edges))
+		for _, update := range conditional.Edges {
+			if keep(update) {
+				updates = append(updates, update)
+			}
+		}
+
+		if len(updates) > 0 {
+			conditional.Edges = updates
+			conditionalEdges = append(conditionalEdges, conditional)
+		}
+	}
+	graph.ConditionalEdges = conditionalEdges
+}
+
+// RemoveEdgesTo removes all edges and conditional updates leading to nodes for which hide returns true. The nodes
+// are kept, so clusters running them still see their updates. Returns the versions which lost incoming edges.
+func (graph *Graph) RemoveEdgesTo(hide func(node Node) bool) []string {
+	hidden := make(map[string]bool)
+	for _, node := range graph.Nodes {
+		if hide(node) {
+			hidden[node.Version] = true
+		}
+	}
+
+	removed := make([]string, 0)
+	if len(hidden) == 0 {
+		return removed
+	}
+	removedVersions := make(map[string]bool)
+
+	edges := make([]Edge, 0, len(graph.Edges))
+	for _, edge := range graph.Edges {
+		if edge.To >= 0 && edge.To < len(graph.Nodes) && hidden[graph.Nodes[edge.To].Version] {
+			removedVersions[graph.Nodes[edge.To].Version] = true
+			continue
+		}
+		edges = append(edges, edge)
+	}
+	graph.Edges = edges
+
+	graph.filterConditionalEdges(func(update ConditionalUpdate) bool {
+		if hidden[update.To] {
+			removedVersions[update.To] = true
+			return false
+		}
+		return true
+	})
+
+	for _, node := range graph.Nodes {
+		if removedVersions[node.Version] {
+			removed = append(removed, node.Version)
+		}
+	}
+	return removed
+}
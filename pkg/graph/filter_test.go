@@ -0,0 +1,163 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func versionSet(versions ...string) func(node Node) bool {
+	set := make(map[string]bool, len(versions))
+	for _, version := range versions {
+		set[version] = true
+	}
+	return func(node Node) bool {
+		return set[node.Version]
+	}
+}
+
+func TestRemoveNodes(t *testing.T) {
+	tests := []struct {
+		name        string
+		remove      []string
+		removed     []string
+		nodes       []string
+		edges       []Edge
+		conditional []ConditionalEdge
+	}{
+		{
+			name:    "nothing",
+			remove:  []string{"4.15.0"},
+			removed: []string{},
+			nodes:   []string{"4.14.1", "4.14.2", "4.14.3"},
+			edges:   []Edge{{0, 1}, {1, 2}, {0, 2}},
+			conditional: []ConditionalEdge{{
+				Edges: []ConditionalUpdate{{From: "4.14.1", To: "4.14.3"}},
+			}},
+		},
+		{
+			name:    "first node",
+			remove:  []string{"4.14.1"},
+			removed: []string{"4.14.1"},
+			nodes:   []string{"4.14.2", "4.14.3"},
+			edges:   []Edge{{0, 1}},
+			// the conditional edge lost its only update
+			conditional: []ConditionalEdge{},
+		},
+		{
+			name:    "middle node",
+			remove:  []string{"4.14.2"},
+			removed: []string{"4.14.2"},
+			nodes:   []string{"4.14.1", "4.14.3"},
+			edges:   []Edge{{0, 1}},
+			conditional: []ConditionalEdge{{
+				Edges: []ConditionalUpdate{{From: "4.14.1", To: "4.14.3"}},
+			}},
+		},
+		{
+			name:        "last node",
+			remove:      []string{"4.14.3"},
+			removed:     []string{"4.14.3"},
+			nodes:       []string{"4.14.1", "4.14.2"},
+			edges:       []Edge{{0, 1}},
+			conditional: []ConditionalEdge{},
+		},
+		{
+			name:        "all nodes",
+			remove:      []string{"4.14.1", "4.14.2", "4.14.3"},
+			removed:     []string{"4.14.1", "4.14.2", "4.14.3"},
+			nodes:       []string{},
+			edges:       []Edge{},
+			conditional: []ConditionalEdge{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			graph := parseTestGraph(t)
+
+			removed := graph.RemoveNodes(versionSet(test.remove...))
+			if !reflect.DeepEqual(removed, test.removed) {
+				t.Errorf("expected removed %v, got %v", test.removed, removed)
+			}
+			if versions := graph.Versions(); !reflect.DeepEqual(versions, test.nodes) {
+				t.Errorf("expected nodes %v, got %v", test.nodes, versions)
+			}
+			if !reflect.DeepEqual(graph.Edges, test.edges) {
+				t.Errorf("expected edges %v, got %v", test.edges, graph.Edges)
+			}
+
+			if len(graph.ConditionalEdges) != len(test.conditional) {
+				t.Fatalf("expected %d conditional edges, got %+v", len(test.conditional), graph.ConditionalEdges)
+			}
+			for i, conditional := range test.conditional {
+				if !reflect.DeepEqual(graph.ConditionalEdges[i].Edges, conditional.Edges) {
+					t.Errorf("expected conditional updates %+v, got %+v", conditional.Edges, graph.ConditionalEdges[i].Edges)
+				}
+			}
+
+			// the filtered graph must still be valid
+			if err := graph.Validate(); err != nil {
+				t.Errorf("filtered graph is invalid: %v", err)
+			}
+		})
+	}
+}
+
+func TestRemoveEdgesTo(t *testing.T) {
+	graph := parseTestGraph(t)
+
+	removed := graph.RemoveEdgesTo(versionSet("4.14.3"))
+	if !reflect.DeepEqual(removed, []string{"4.14.3"}) {
+		t.Errorf("expected removed [4.14.3], got %v", removed)
+	}
+	if versions := graph.Versions(); len(versions) != 3 {
+		t.Errorf("expected nodes to be kept, got %v", versions)
+	}
+	if !reflect.DeepEqual(graph.Edges, []Edge{{0, 1}}) {
+		t.Errorf("unexpected edges %v", graph.Edges)
+	}
+	if len(graph.ConditionalEdges) != 0 {
+		t.Errorf("unexpected conditional edges %+v", graph.ConditionalEdges)
+	}
+}
+
+func TestRemoveDanglingUpdates(t *testing.T) {
+	input := `{
+		"nodes": [{"version": "4.14.1", "payload": "a"}, {"version": "4.14.2", "payload": "b"}],
+		"edges": [[0, 1]],
+		"conditionalEdges": [
+			{
+				"edges": [{"from": "4.14.1", "to": "4.14.2"}, {"from": "4.14.1", "to": "4.14.9"}],
+				"risks": [{"url": "u", "name": "A", "message": "m", "matchingRules": [{"type": "Always"}]}]
+			},
+			{
+				"edges": [{"from": "4.13.9", "to": "4.14.2"}],
+				"risks": [{"url": "u", "name": "B", "message": "m", "matchingRules": [{"type": "Always"}]}]
+			}
+		]
+	}`
+
+	// dangling updates do not make the graph invalid
+	graph, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dangling := graph.RemoveDanglingUpdates()
+	if !reflect.DeepEqual(dangling, []ConditionalUpdate{{From: "4.14.1", To: "4.14.9"}, {From: "4.13.9", To: "4.14.2"}}) {
+		t.Errorf("unexpected dangling updates %+v", dangling)
+	}
+	if versions := graph.Versions(); !reflect.DeepEqual(versions, []string{"4.14.1", "4.14.2"}) {
+		t.Errorf("expected nodes to be kept, got %v", versions)
+	}
+	if !reflect.DeepEqual(graph.Edges, []Edge{{0, 1}}) {
+		t.Errorf("expected edges to be kept, got %v", graph.Edges)
+	}
+	if len(graph.ConditionalEdges) != 1 || !reflect.DeepEqual(graph.ConditionalEdges[0].Edges, []ConditionalUpdate{{From: "4.14.1", To: "4.14.2"}}) {
+		t.Errorf("unexpected conditional edges %+v", graph.ConditionalEdges)
+	}
+
+	if dangling := graph.RemoveDanglingUpdates(); len(dangling) != 0 {
+		t.Errorf("expected no dangling updates left, got %+v", dangling)
+	}
+}
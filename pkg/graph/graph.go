@@ -0,0 +1,225 @@
+// Package graph implements the Cincinnati v1 update graph as served by the OpenShift update service.
+//
+// All types keep fields unknown to this package, so a graph can be parsed, modified and serialized again
+// without losing information added by newer upstream versions.
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Graph is a Cincinnati update graph. Edges reference nodes by their index, conditional edges reference
+// nodes by their version. ConditionalEdges is nil if the field is absent, an empty but present list is
+// serialized again as [].
+type Graph struct {
+	Nodes            []Node            `json:"nodes"`
+	Edges            []Edge            `json:"edges"`
+	ConditionalEdges []ConditionalEdge `json:"conditionalEdges,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Node is a release in the graph. Metadata is nil if the field is absent, an empty but present object is
+// serialized again as {}.
+type Node struct {
+	Version  string            `json:"version"`
+	Payload  string            `json:"payload"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Edge is an update from the node at index From to the node at index To. It is serialized as pair [From, To].
+type Edge struct {
+	From int
+	To   int
+}
+
+// ConditionalEdge is a group of updates which are only recommended if none of the risks apply to the cluster
+type ConditionalEdge struct {
+	Edges []ConditionalUpdate `json:"edges"`
+	Risks []Risk              `json:"risks"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type ConditionalUpdate struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type Risk struct {
+	URL           string         `json:"url"`
+	Name          string         `json:"name"`
+	Message       string         `json:"message"`
+	MatchingRules []MatchingRule `json:"matchingRules"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+const (
+	MATCHING_RULE_ALWAYS = "Always"
+	MATCHING_RULE_PROMQL = "PromQL"
+)
+
+// MatchingRule decides whether a risk applies to a cluster. PromQL is only set for rules of type PromQL.
+type MatchingRule struct {
+	Type   string      `json:"type"`
+	PromQL *PromQLRule `json:"promql,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type PromQLRule struct {
+	PromQL string `json:"promql"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Parse parses and validates a graph
+func Parse(data []byte) (*Graph, error) {
+	var graph Graph
+	err := json.Unmarshal(data, &graph)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse graph: %w", err)
+	}
+
+	err = graph.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &graph, nil
+}
+
+// Marshal serializes the graph. Fields unknown to this package are written as they were read.
+func (graph *Graph) Marshal() ([]byte, error) {
+	return json.Marshal(graph)
+}
+
+func (graph *Graph) UnmarshalJSON(data []byte) error {
+	type plain Graph
+	err := unmarshalWithExtra(data, (*plain)(graph), &graph.Extra, "nodes", "edges", "conditionalEdges")
+	if err != nil {
+		return err
+	}
+
+	// Edges are always serialized, so a graph without edges is the same as a graph with an empty edge list
+	if graph.Edges == nil {
+		graph.Edges = []Edge{}
+	}
+	return nil
+}
+
+func (graph Graph) MarshalJSON() ([]byte, error) {
+	type plain Graph
+	// Nodes and edges are mandatory, so never serialize them as null
+	if graph.Nodes == nil {
+		graph.Nodes = []Node{}
+	}
+	if graph.Edges == nil {
+		graph.Edges = []Edge{}
+	}
+
+	var conditionalEdges *[]ConditionalEdge
+	if graph.ConditionalEdges != nil {
+		conditionalEdges = &graph.ConditionalEdges
+	}
+
+	// omitempty drops empty slices as well, so only omit the field if it was absent
+	return marshalWithExtra(struct {
+		plain
+		ConditionalEdges *[]ConditionalEdge `json:"conditionalEdges,omitempty"`
+	}{plain(graph), conditionalEdges}, graph.Extra)
+}
+
+func (node *Node) UnmarshalJSON(data []byte) error {
+	type plain Node
+	return unmarshalWithExtra(data, (*plain)(node), &node.Extra, "version", "payload", "metadata")
+}
+
+func (node Node) MarshalJSON() ([]byte, error) {
+	type plain Node
+
+	var metadata *map[string]string
+	if node.Metadata != nil {
+		metadata = &node.Metadata
+	}
+
+	// omitempty drops empty maps as well, so only omit the field if it was absent
+	return marshalWithExtra(struct {
+		plain
+		Metadata *map[string]string `json:"metadata,omitempty"`
+	}{plain(node), metadata}, node.Extra)
+}
+
+func (edge *Edge) UnmarshalJSON(data []byte) error {
+	var pair []int
+	err := json.Unmarshal(data, &pair)
+	if err != nil {
+		return err
+	}
+	if len(pair) != 2 {
+		return fmt.Errorf("edge must be a pair of node indices, got %d elements", len(pair))
+	}
+
+	edge.From, edge.To = pair[0], pair[1]
+	return nil
+}
+
+func (edge Edge) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]int{edge.From, edge.To})
+}
+
+func (edge *ConditionalEdge) UnmarshalJSON(data []byte) error {
+	type plain ConditionalEdge
+	return unmarshalWithExtra(data, (*plain)(edge), &edge.Extra, "edges", "risks")
+}
+
+func (edge ConditionalEdge) MarshalJSON() ([]byte, error) {
+	type plain ConditionalEdge
+	return marshalWithExtra(plain(edge), edge.Extra)
+}
+
+func (update *ConditionalUpdate) UnmarshalJSON(data []byte) error {
+	type plain ConditionalUpdate
+	return unmarshalWithExtra(data, (*plain)(update), &update.Extra, "from", "to")
+}
+
+func (update ConditionalUpdate) MarshalJSON() ([]byte, error) {
+	type plain ConditionalUpdate
+	return marshalWithExtra(plain(update), update.Extra)
+}
+
+func (risk *Risk) UnmarshalJSON(data []byte) error {
+	type plain Risk
+	return unmarshalWithExtra(data, (*plain)(risk), &risk.Extra, "url", "name", "message", "matchingRules")
+}
+
+func (risk Risk) MarshalJSON() ([]byte, error) {
+	type plain Risk
+	return marshalWithExtra(plain(risk), risk.Extra)
+}
+
+func (rule *MatchingRule) UnmarshalJSON(data []byte) error {
+	type plain MatchingRule
+	return unmarshalWithExtra(data, (*plain)(rule), &rule.Extra, "type", "promql")
+}
+
+func (rule MatchingRule) MarshalJSON() ([]byte, error) {
+	type plain MatchingRule
+	return marshalWithExtra(plain(rule), rule.Extra)
+}
+
+func (rule *PromQLRule) UnmarshalJSON(data []byte) error {
+	type plain PromQLRule
+	return unmarshalWithExtra(data, (*plain)(rule), &rule.Extra, "promql")
+}
+
+func (rule PromQLRule) MarshalJSON() ([]byte, error) {
+	type plain PromQLRule
+	return marshalWithExtra(plain(rule), rule.Extra)
+}
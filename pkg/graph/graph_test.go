@@ -0,0 +1,154 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testGraph = `{
+	"nodes": [
+		{"version": "4.14.1", "payload": "quay.io/openshift-release-dev/ocp-release@sha256:1", "metadata": {"io.openshift.upgrades.graph.release.channels": "stable-4.14"}},
+		{"version": "4.14.2", "payload": "quay.io/openshift-release-dev/ocp-release@sha256:2", "metadata": {}},
+		{"version": "4.14.3", "payload": "quay.io/openshift-release-dev/ocp-release@sha256:3", "future": true}
+	],
+	"edges": [[0, 1], [1, 2], [0, 2]],
+	"conditionalEdges": [
+		{
+			"edges": [{"from": "4.14.1", "to": "4.14.3"}],
+			"risks": [{"url": "https://example.com", "name": "Risk", "message": "message", "matchingRules": [{"type": "PromQL", "promql": {"promql": "up"}}]}]
+		}
+	],
+	"future": {"field": [1, 2, 3]}
+}`
+
+func parseTestGraph(t *testing.T) *Graph {
+	t.Helper()
+
+	graph, err := Parse([]byte(testGraph))
+	if err != nil {
+		t.Fatalf("cannot parse test graph: %v", err)
+	}
+	return graph
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "full graph", input: testGraph},
+		{name: "empty graph", input: `{"nodes":[],"edges":[]}`},
+		{name: "empty conditional edges", input: `{"nodes":[],"edges":[],"conditionalEdges":[]}`},
+		{name: "empty metadata", input: `{"nodes":[{"version":"4.14.1","payload":"p","metadata":{}}],"edges":[]}`},
+		{name: "absent metadata", input: `{"nodes":[{"version":"4.14.1","payload":"p"}],"edges":[]}`},
+		{name: "unknown fields", input: `{"nodes":[{"version":"4.14.1","payload":"p","new":"x"}],"edges":[],"new":{"a":1}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			graph, err := Parse([]byte(test.input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			data, err := graph.Marshal()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var expected, actual interface{}
+			if err := json.Unmarshal([]byte(test.input), &expected); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(data, &actual); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("round trip changed the graph\nexpected: %s\nactual:   %s", test.input, data)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "no json", input: `<html>error</html>`},
+		{name: "no nodes", input: `{"edges":[]}`},
+		{name: "node without version", input: `{"nodes":[{"payload":"p"}],"edges":[]}`},
+		{name: "node without payload", input: `{"nodes":[{"version":"4.14.1"}],"edges":[]}`},
+		{name: "duplicate node", input: `{"nodes":[{"version":"4.14.1","payload":"p"},{"version":"4.14.1","payload":"p"}],"edges":[]}`},
+		{name: "edge out of range", input: `{"nodes":[{"version":"4.14.1","payload":"p"}],"edges":[[0,1]]}`},
+		{name: "edge not a pair", input: `{"nodes":[{"version":"4.14.1","payload":"p"}],"edges":[[0]]}`},
+		{name: "conditional edge without updates", input: `{"nodes":[{"version":"4.14.1","payload":"p"}],"edges":[],"conditionalEdges":[{"edges":[],"risks":[{"url":"u","name":"n","message":"m","matchingRules":[{"type":"Always"}]}]}]}`},
+		{name: "risk without matching rules", input: `{"nodes":[{"version":"4.14.1","payload":"p"},{"version":"4.14.2","payload":"p2"}],"edges":[],"conditionalEdges":[{"edges":[{"from":"4.14.1","to":"4.14.2"}],"risks":[{"url":"u","name":"n","message":"m","matchingRules":[]}]}]}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse([]byte(test.input))
+			if err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add([]byte(testGraph))
+	f.Add([]byte(`{"nodes":[],"edges":[]}`))
+	f.Add([]byte(`{"nodes":[{"version":"4.14.1","payload":"p","metadata":{}}],"edges":[[0,0]],"conditionalEdges":[]}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		graph, err := Parse(data)
+		if err != nil {
+			return
+		}
+
+		// every parsed graph must be safe to query
+		for _, version := range graph.Versions() {
+			graph.Successors(version)
+			graph.Predecessors(version)
+			graph.ConditionalSuccessors(version)
+		}
+	})
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add([]byte(testGraph))
+	f.Add([]byte(`{"nodes":[],"edges":[],"conditionalEdges":[]}`))
+	f.Add([]byte(`{"nodes":[{"version":"4.14.1","payload":"p","metadata":{}}],"edges":[[0,0]],"x":null}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		graph, err := Parse(data)
+		if err != nil {
+			return
+		}
+
+		marshalled, err := graph.Marshal()
+		if err != nil {
+			t.Fatalf("cannot marshal parsed graph: %v", err)
+		}
+
+		reparsed, err := Parse(marshalled)
+		if err != nil {
+			t.Fatalf("cannot parse marshalled graph: %v\n%s", err, marshalled)
+		}
+
+		if !reflect.DeepEqual(graph, reparsed) {
+			t.Fatalf("round trip changed the graph\ninput:  %s\noutput: %s", data, marshalled)
+		}
+
+		remarshalled, err := reparsed.Marshal()
+		if err != nil {
+			t.Fatalf("cannot marshal reparsed graph: %v", err)
+		}
+		if !bytes.Equal(marshalled, remarshalled) {
+			t.Fatalf("serialization is not stable\nfirst:  %s\nsecond: %s", marshalled, remarshalled)
+		}
+	})
+}
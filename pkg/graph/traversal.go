@@ -0,0 +1,79 @@
+package graph
+
+// Index returns the index of the node with the given version
+func (graph *Graph) Index(version string) (int, bool) {
+	for i := range graph.Nodes {
+		if graph.Nodes[i].Version == version {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// Node returns the node with the given version
+func (graph *Graph) Node(version string) (*Node, bool) {
+	index, ok := graph.Index(version)
+	if !ok {
+		return nil, false
+	}
+	return &graph.Nodes[index], true
+}
+
+// Versions returns the versions of all nodes in graph order
+func (graph *Graph) Versions() []string {
+	versions := make([]string, 0, len(graph.Nodes))
+	for _, node := range graph.Nodes {
+		versions = append(versions, node.Version)
+	}
+	return versions
+}
+
+// Successors returns the nodes which can be updated to unconditionally from the given version
+func (graph *Graph) Successors(version string) []Node {
+	index, ok := graph.Index(version)
+	if !ok {
+		return nil
+	}
+
+	successors := make([]Node, 0)
+	for _, edge := range graph.Edges {
+		if edge.From == index && edge.To >= 0 && edge.To < len(graph.Nodes) {
+			successors = append(successors, graph.Nodes[edge.To])
+		}
+	}
+	return successors
+}
+
+// Predecessors returns the nodes which can be updated unconditionally to the given version
+func (graph *Graph) Predecessors(version string) []Node {
+	index, ok := graph.Index(version)
+	if !ok {
+		return nil
+	}
+
+	predecessors := make([]Node, 0)
+	for _, edge := range graph.Edges {
+		if edge.To == index && edge.From >= 0 && edge.From < len(graph.Nodes) {
+			predecessors = append(predecessors, graph.Nodes[edge.From])
+		}
+	}
+	return predecessors
+}
+
+// ConditionalSuccessors returns the conditional edges starting at the given version. Each returned edge contains
+// only the update from the given version together with its risks.
+func (graph *Graph) ConditionalSuccessors(version string) []ConditionalEdge {
+	successors := make([]ConditionalEdge, 0)
+	for _, conditional := range graph.ConditionalEdges {
+		for _, update := range conditional.Edges {
+			if update.From == version {
+				successors = append(successors, ConditionalEdge{
+					Edges: []ConditionalUpdate{update},
+					Risks: conditional.Risks,
+					Extra: conditional.Extra,
+				})
+			}
+		}
+	}
+	return successors
+}
@@ -0,0 +1,114 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func nodeVersions(nodes []Node) []string {
+	if nodes == nil {
+		return nil
+	}
+
+	versions := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		versions = append(versions, node.Version)
+	}
+	return versions
+}
+
+func TestSuccessors(t *testing.T) {
+	graph := parseTestGraph(t)
+
+	tests := []struct {
+		version  string
+		expected []string
+	}{
+		{version: "4.14.1", expected: []string{"4.14.2", "4.14.3"}},
+		{version: "4.14.2", expected: []string{"4.14.3"}},
+		{version: "4.14.3", expected: []string{}},
+		{version: "4.15.0", expected: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.version, func(t *testing.T) {
+			actual := nodeVersions(graph.Successors(test.version))
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPredecessors(t *testing.T) {
+	graph := parseTestGraph(t)
+
+	tests := []struct {
+		version  string
+		expected []string
+	}{
+		{version: "4.14.1", expected: []string{}},
+		{version: "4.14.2", expected: []string{"4.14.1"}},
+		{version: "4.14.3", expected: []string{"4.14.2", "4.14.1"}},
+		{version: "4.15.0", expected: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.version, func(t *testing.T) {
+			actual := nodeVersions(graph.Predecessors(test.version))
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestNode(t *testing.T) {
+	graph := parseTestGraph(t)
+
+	tests := []struct {
+		version string
+		found   bool
+		payload string
+	}{
+		{version: "4.14.1", found: true, payload: "quay.io/openshift-release-dev/ocp-release@sha256:1"},
+		{version: "4.14.3", found: true, payload: "quay.io/openshift-release-dev/ocp-release@sha256:3"},
+		{version: "4.15.0", found: false},
+		{version: "", found: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.version, func(t *testing.T) {
+			node, ok := graph.Node(test.version)
+			if ok != test.found {
+				t.Fatalf("expected found %v, got %v", test.found, ok)
+			}
+			if !ok {
+				return
+			}
+			if node.Version != test.version || node.Payload != test.payload {
+				t.Errorf("unexpected node %+v", node)
+			}
+		})
+	}
+
+	// the returned node points into the graph
+	node, _ := graph.Node("4.14.2")
+	node.Payload = "changed"
+	if graph.Nodes[1].Payload != "changed" {
+		t.Error("node is not a reference into the graph")
+	}
+}
+
+func TestConditionalSuccessors(t *testing.T) {
+	graph := parseTestGraph(t)
+
+	successors := graph.ConditionalSuccessors("4.14.1")
+	if len(successors) != 1 || successors[0].Edges[0].To != "4.14.3" || successors[0].Risks[0].Name != "Risk" {
+		t.Errorf("unexpected conditional successors %+v", successors)
+	}
+
+	if successors := graph.ConditionalSuccessors("4.14.2"); len(successors) != 0 {
+		t.Errorf("expected no conditional successors, got %+v", successors)
+	}
+}
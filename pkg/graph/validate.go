@@ -0,0 +1,80 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Validate checks that the graph is well-formed: every node has a unique version and a payload, edges reference
+// existing nodes and conditional edges have updates and risks with matching rules. Conditional updates from or to
+// unknown versions are ignored by the cluster version operator, so they are no error; see RemoveDanglingUpdates.
+func (graph *Graph) Validate() error {
+	if graph.Nodes == nil {
+		return errors.New("graph has no nodes")
+	}
+
+	versions := make(map[string]bool, len(graph.Nodes))
+	for i, node := range graph.Nodes {
+		if len(node.Version) == 0 {
+			return fmt.Errorf("node %d has no version", i)
+		}
+		if len(node.Payload) == 0 {
+			return fmt.Errorf("node %d (%s) has no payload", i, node.Version)
+		}
+		if versions[node.Version] {
+			return fmt.Errorf("duplicate node %s", node.Version)
+		}
+		versions[node.Version] = true
+	}
+
+	for i, edge := range graph.Edges {
+		for _, index := range []int{edge.From, edge.To} {
+			if index < 0 || index >= len(graph.Nodes) {
+				return fmt.Errorf("edge %d references unknown node %d", i, index)
+			}
+		}
+	}
+
+	for i, conditional := range graph.ConditionalEdges {
+		err := conditional.validate()
+		if err != nil {
+			return fmt.Errorf("conditional edge %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// validate checks that the conditional edge has updates and risks with matching rules
+func (edge *ConditionalEdge) validate() error {
+	if len(edge.Edges) == 0 {
+		return errors.New("no edges")
+	}
+	for _, update := range edge.Edges {
+		if len(update.From) == 0 || len(update.To) == 0 {
+			return errors.New("edge without from or to")
+		}
+	}
+
+	if len(edge.Risks) == 0 {
+		return errors.New("no risks")
+	}
+	for _, risk := range edge.Risks {
+		if len(risk.Name) == 0 || len(risk.URL) == 0 || len(risk.Message) == 0 {
+			return errors.New("risk without name, url or message")
+		}
+		if len(risk.MatchingRules) == 0 {
+			return fmt.Errorf("risk %s has no matching rules", risk.Name)
+		}
+		for _, rule := range risk.MatchingRules {
+			if len(rule.Type) == 0 {
+				return fmt.Errorf("risk %s has a matching rule without type", risk.Name)
+			}
+			if rule.Type == MATCHING_RULE_PROMQL && (rule.PromQL == nil || len(rule.PromQL.PromQL) == 0) {
+				return fmt.Errorf("risk %s has a PromQL rule without query", risk.Name)
+			}
+		}
+	}
+
+	return nil
+}
@@ -17,15 +17,40 @@ type UpdateProxyMetrics struct {
 	MetricCacheHit  *prometheus.CounterVec
 	MetricCacheMiss *prometheus.CounterVec
 	CacheSize       *prometheus.GaugeVec
+	CacheBytes      *prometheus.GaugeVec
+	CacheEvictions  *prometheus.CounterVec
 	VersionAccessed *prometheus.CounterVec
 	Healthcheck     prometheus.Counter
 
 	UpstreamResponseTime *prometheus.HistogramVec
-	ResponseTime         *prometheus.HistogramVec
-	ErrorResponses       *prometheus.CounterVec
+	UpstreamCoalesced    *prometheus.CounterVec
+	UpstreamShared       *prometheus.CounterVec
+	UpstreamRetries      *prometheus.CounterVec
+	UpstreamCircuitState *prometheus.GaugeVec
 
-	RefreshCounter *prometheus.CounterVec
-	RefreshErrors  *prometheus.CounterVec
+	UpstreamValidationFailures *prometheus.CounterVec
+	// UpstreamValidationWarnings counts conditional updates to unknown versions removed from upstream graphs
+	UpstreamValidationWarnings *prometheus.CounterVec
+
+	UpstreamEndpointRequests *prometheus.CounterVec
+	UpstreamEndpointHealthy  *prometheus.GaugeVec
+
+	ResponseTime   *prometheus.HistogramVec
+	ErrorResponses *prometheus.CounterVec
+
+	RefreshCounter      *prometheus.CounterVec
+	RevalidationCounter *prometheus.CounterVec
+	RefreshErrors       *prometheus.CounterVec
+	StaleResponses      *prometheus.CounterVec
+
+	RefreshCycleDuration *prometheus.HistogramVec
+	RefreshQueueDepth    *prometheus.GaugeVec
+	RefreshSkipped       *prometheus.CounterVec
+
+	PolicyRemovedVersions *prometheus.CounterVec
+	// PolicyHeldReleases is the unix time a release held back by the soak period becomes visible
+	PolicyHeldReleases    *prometheus.GaugeVec
+	PolicyPendingReleases *prometheus.GaugeVec
 }
 
 func NewUpdateProxyMetrics(cfg *config.UpdateProxyConfig) *UpdateProxyMetrics {
@@ -33,18 +58,41 @@ func NewUpdateProxyMetrics(cfg *config.UpdateProxyConfig) *UpdateProxyMetrics {
 	mux.Handle("/metrics", promhttp.Handler())
 
 	return &UpdateProxyMetrics{
-		MetricCacheMiss: promauto.NewCounterVec(utils.Counter("cache", "miss"), []string{"arch", "channel", "version"}),
-		MetricCacheHit:  promauto.NewCounterVec(utils.Counter("cache", "hit"), []string{"arch", "channel", "version"}),
-		CacheSize:       promauto.NewGaugeVec(utils.Gauge("cache", "size"), []string{"endpoint"}),
-		VersionAccessed: promauto.NewCounterVec(utils.Counter("version", "access"), []string{"arch", "channel", "version"}),
+		MetricCacheMiss: promauto.NewCounterVec(utils.Counter("cache", "miss"), []string{"upstream", "arch", "channel", "version"}),
+		MetricCacheHit:  promauto.NewCounterVec(utils.Counter("cache", "hit"), []string{"upstream", "arch", "channel", "version"}),
+		CacheSize:       promauto.NewGaugeVec(utils.Gauge("cache", "size"), []string{"upstream"}),
+		CacheBytes:      promauto.NewGaugeVec(utils.Gauge("cache", "bytes"), []string{"upstream"}),
+		CacheEvictions:  promauto.NewCounterVec(utils.Counter("cache", "evictions"), []string{"upstream", "reason"}),
+		VersionAccessed: promauto.NewCounterVec(utils.Counter("version", "access"), []string{"upstream", "arch", "channel", "version"}),
 		Healthcheck:     promauto.NewCounter(utils.Counter("healthcheck", "requests")),
 
-		UpstreamResponseTime: promauto.NewHistogramVec(utils.Histogram("upstream", "response_time_ms"), []string{"arch", "channel", "version"}),
-		ResponseTime:         promauto.NewHistogramVec(utils.Histogram("version", "response_time_ms"), []string{"endpoint"}),
+		UpstreamResponseTime: promauto.NewHistogramVec(utils.Histogram("upstream", "response_time_ms"), []string{"upstream", "arch", "channel", "version"}),
+		UpstreamCoalesced:    promauto.NewCounterVec(utils.Counter("upstream", "coalesced_requests"), []string{"upstream", "arch", "channel", "version"}),
+		UpstreamShared:       promauto.NewCounterVec(utils.Counter("upstream", "shared_responses"), []string{"upstream", "arch", "channel", "version"}),
+		UpstreamRetries:      promauto.NewCounterVec(utils.Counter("upstream", "retries"), []string{"upstream"}),
+		UpstreamCircuitState: promauto.NewGaugeVec(utils.Gauge("upstream", "circuit_state"), []string{"upstream"}),
+
+		UpstreamValidationFailures: promauto.NewCounterVec(utils.Counter("upstream", "validation_failures"), []string{"upstream", "endpoint"}),
+		UpstreamValidationWarnings: promauto.NewCounterVec(utils.Counter("upstream", "validation_warnings"), []string{"upstream", "endpoint"}),
 
-		ErrorResponses: promauto.NewCounterVec(utils.Counter("response", "errors"), []string{"path"}),
-		RefreshCounter: promauto.NewCounterVec(utils.Counter("version", "refreshed"), []string{"arch", "channel", "version"}),
-		RefreshErrors:  promauto.NewCounterVec(utils.Counter("version", "refresh_errors"), []string{"arch", "channel", "version"}),
+		UpstreamEndpointRequests: promauto.NewCounterVec(utils.Counter("upstream", "endpoint_requests"), []string{"upstream", "endpoint", "result"}),
+		UpstreamEndpointHealthy:  promauto.NewGaugeVec(utils.Gauge("upstream", "endpoint_healthy"), []string{"upstream", "endpoint"}),
+
+		ResponseTime: promauto.NewHistogramVec(utils.Histogram("version", "response_time_ms"), []string{"endpoint"}),
+
+		ErrorResponses:      promauto.NewCounterVec(utils.Counter("response", "errors"), []string{"path"}),
+		RefreshCounter:      promauto.NewCounterVec(utils.Counter("version", "refreshed"), []string{"upstream", "arch", "channel", "version"}),
+		RevalidationCounter: promauto.NewCounterVec(utils.Counter("version", "revalidated"), []string{"upstream", "arch", "channel", "version"}),
+		RefreshErrors:       promauto.NewCounterVec(utils.Counter("version", "refresh_errors"), []string{"upstream", "arch", "channel", "version"}),
+		StaleResponses:      promauto.NewCounterVec(utils.Counter("version", "stale_responses"), []string{"upstream", "arch", "channel", "version", "reason"}),
+
+		RefreshCycleDuration: promauto.NewHistogramVec(refreshCycleHistogram(), []string{"upstream"}),
+		RefreshQueueDepth:    promauto.NewGaugeVec(utils.Gauge("refresh", "queue_depth"), []string{"upstream"}),
+		RefreshSkipped:       promauto.NewCounterVec(utils.Counter("refresh", "skipped"), []string{"upstream"}),
+
+		PolicyRemovedVersions: promauto.NewCounterVec(utils.Counter("policy", "removed_versions"), []string{"upstream", "policy"}),
+		PolicyHeldReleases:    promauto.NewGaugeVec(utils.Gauge("policy", "held_release_visible_at_seconds"), []string{"upstream", "channel", "version"}),
+		PolicyPendingReleases: promauto.NewGaugeVec(utils.Gauge("policy", "pending_releases"), []string{"upstream", "channel"}),
 
 		Server: http.Server{
 			Handler: mux,
@@ -53,6 +101,13 @@ func NewUpdateProxyMetrics(cfg *config.UpdateProxyConfig) *UpdateProxyMetrics {
 	}
 }
 
+// refreshCycleHistogram covers cycles from 100ms up to about half an hour
+func refreshCycleHistogram() prometheus.HistogramOpts {
+	opts := utils.Histogram("refresh", "cycle_duration_seconds")
+	opts.Buckets = prometheus.ExponentialBuckets(0.1, 2, 15)
+	return opts
+}
+
 func (metrics *UpdateProxyMetrics) Run() error {
 	return metrics.Server.ListenAndServe()
 }
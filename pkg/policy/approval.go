@@ -0,0 +1,140 @@
+package policy
+
+import (
+	"errors"
+	"github.com/lukeelten/openshift-update-proxy/pkg/graph"
+	"github.com/lukeelten/openshift-update-proxy/pkg/metrics"
+	"sort"
+	"time"
+)
+
+const (
+	POLICY_APPROVAL = "approval"
+
+	DECISION_APPROVED = "approved"
+	DECISION_REJECTED = "rejected"
+)
+
+// Decision approves or rejects a release. An empty channel applies to all channels without own decision.
+type Decision struct {
+	Channel  string    `json:"channel,omitempty"`
+	Version  string    `json:"version"`
+	Decision string    `json:"decision"`
+	User     string    `json:"user,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// PendingRelease is a release waiting for a decision
+type PendingRelease struct {
+	Channel   string    `json:"channel"`
+	Version   string    `json:"version"`
+	FirstSeen time.Time `json:"firstSeen"`
+}
+
+// Approval removes releases from the graph which appeared in a channel after it was first seen, until they are
+// approved. Rejected releases are removed as well. The release the requesting cluster is running is kept.
+type Approval struct {
+	upstream string
+	enabled  bool
+	state    *State
+	metrics  *metrics.UpdateProxyMetrics
+}
+
+var _ Filter = &Approval{}
+
+func NewApproval(upstream string, enabled bool, state *State, m *metrics.UpdateProxyMetrics) *Approval {
+	return &Approval{
+		upstream: upstream,
+		enabled:  enabled,
+		state:    state,
+		metrics:  m,
+	}
+}
+
+func (approval *Approval) Name() string {
+	return POLICY_APPROVAL
+}
+
+func (approval *Approval) Applies(request Request) bool {
+	return approval.enabled
+}
+
+func (approval *Approval) Apply(request Request, g *graph.Graph) []string {
+	if len(g.Nodes) == 0 {
+		// unknown channel, nothing to record
+		return nil
+	}
+
+	firstSeen := approval.state.RecordFirstSeen(request.Channel, g.Versions(), time.Now())
+
+	pending := 0
+	removed := g.RemoveNodes(func(node graph.Node) bool {
+		status := approval.status(request.Channel, node.Version, firstSeen[node.Version])
+		if status == "" {
+			pending++
+		}
+		return node.Version != request.Version && status != DECISION_APPROVED
+	})
+
+	approval.metrics.PolicyPendingReleases.WithLabelValues(approval.upstream, request.Channel).Set(float64(pending))
+	return removed
+}
+
+// status returns the decision for the release, approved for releases which were present when the channel was
+// first seen and an empty string for pending releases
+func (approval *Approval) status(channel, version string, firstSeen time.Time) string {
+	if decision, ok := approval.state.Decision(channel, version); ok {
+		return decision.Decision
+	}
+	if firstSeen.IsZero() {
+		return DECISION_APPROVED
+	}
+	return ""
+}
+
+// Pending returns all releases without decision, ordered by the time they were first seen
+func (approval *Approval) Pending() []PendingRelease {
+	pending := make([]PendingRelease, 0)
+	if !approval.enabled {
+		return pending
+	}
+
+	for channel, seen := range approval.state.FirstSeen() {
+		for version, firstSeen := range seen {
+			if approval.status(channel, version, firstSeen) == "" {
+				pending = append(pending, PendingRelease{Channel: channel, Version: version, FirstSeen: firstSeen})
+			}
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].FirstSeen.Before(pending[j].FirstSeen)
+	})
+	return pending
+}
+
+// Decisions returns all decisions, latest first
+func (approval *Approval) Decisions() []Decision {
+	decisions := approval.state.Decisions()
+	sort.Slice(decisions, func(i, j int) bool {
+		return decisions[i].Time.After(decisions[j].Time)
+	})
+	return decisions
+}
+
+// Decide validates and stores a decision
+func (approval *Approval) Decide(decision Decision) error {
+	if decision.Decision != DECISION_APPROVED && decision.Decision != DECISION_REJECTED {
+		return errors.New("decision must be approved or rejected")
+	}
+	if _, err := ParseVersion(decision.Version); err != nil {
+		return err
+	}
+	return approval.state.SetDecision(decision)
+}
+
+// Revoke removes a decision, so the release is pending again
+func (approval *Approval) Revoke(channel, version string) error {
+	return approval.state.DeleteDecision(channel, version)
+}
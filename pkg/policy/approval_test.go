@@ -0,0 +1,197 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApprovalApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		seen      []string
+		decisions []Decision
+		version   string
+		removed   []string
+		nodes     []string
+	}{
+		{
+			name:    "first sighting approves all releases",
+			version: "4.14.1",
+			removed: []string{},
+			nodes:   []string{"4.14.1", "4.14.2", "4.14.3"},
+		},
+		{
+			name:    "pending releases are removed",
+			seen:    []string{"4.14.1"},
+			version: "4.14.1",
+			removed: []string{"4.14.2", "4.14.3"},
+			nodes:   []string{"4.14.1"},
+		},
+		{
+			name:      "approved release",
+			seen:      []string{"4.14.1"},
+			decisions: []Decision{{Channel: "stable-4.14", Version: "4.14.2", Decision: DECISION_APPROVED}},
+			version:   "4.14.1",
+			removed:   []string{"4.14.3"},
+			nodes:     []string{"4.14.1", "4.14.2"},
+		},
+		{
+			name:      "approval for all channels",
+			seen:      []string{"4.14.1"},
+			decisions: []Decision{{Version: "4.14.3", Decision: DECISION_APPROVED}},
+			version:   "4.14.1",
+			removed:   []string{"4.14.2"},
+			nodes:     []string{"4.14.1", "4.14.3"},
+		},
+		{
+			name:      "approval for other channel",
+			seen:      []string{"4.14.1"},
+			decisions: []Decision{{Channel: "fast-4.14", Version: "4.14.2", Decision: DECISION_APPROVED}},
+			version:   "4.14.1",
+			removed:   []string{"4.14.2", "4.14.3"},
+			nodes:     []string{"4.14.1"},
+		},
+		{
+			name:      "rejection of release present at first sighting",
+			decisions: []Decision{{Version: "4.14.2", Decision: DECISION_REJECTED}},
+			version:   "4.14.1",
+			removed:   []string{"4.14.2"},
+			nodes:     []string{"4.14.1", "4.14.3"},
+		},
+		{
+			name: "channel rejection takes precedence over global approval",
+			seen: []string{"4.14.1"},
+			decisions: []Decision{
+				{Version: "4.14.2", Decision: DECISION_APPROVED},
+				{Version: "4.14.3", Decision: DECISION_APPROVED},
+				{Channel: "stable-4.14", Version: "4.14.3", Decision: DECISION_REJECTED},
+			},
+			version: "4.14.1",
+			removed: []string{"4.14.3"},
+			nodes:   []string{"4.14.1", "4.14.2"},
+		},
+		{
+			name: "channel approval takes precedence over global rejection",
+			seen: []string{"4.14.1"},
+			decisions: []Decision{
+				{Version: "4.14.2", Decision: DECISION_REJECTED},
+				{Channel: "stable-4.14", Version: "4.14.2", Decision: DECISION_APPROVED},
+			},
+			version: "4.14.1",
+			removed: []string{"4.14.3"},
+			nodes:   []string{"4.14.1", "4.14.2"},
+		},
+		{
+			name:    "running pending release is kept",
+			seen:    []string{"4.14.1"},
+			version: "4.14.2",
+			removed: []string{"4.14.3"},
+			nodes:   []string{"4.14.1", "4.14.2"},
+		},
+		{
+			name:      "running rejected release is kept",
+			seen:      []string{"4.14.1", "4.14.3"},
+			decisions: []Decision{{Version: "4.14.2", Decision: DECISION_REJECTED}},
+			version:   "4.14.2",
+			removed:   []string{},
+			nodes:     []string{"4.14.1", "4.14.2", "4.14.3"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := newTestState(t)
+			if len(test.seen) > 0 {
+				state.RecordFirstSeen("stable-4.14", test.seen, time.Now())
+			}
+			approval := NewApproval("test", true, state, newTestMetrics())
+			for _, decision := range test.decisions {
+				if err := approval.Decide(decision); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			request := Request{Arch: "amd64", Channel: "stable-4.14", Version: test.version}
+			if !approval.Applies(request) {
+				t.Fatal("approval does not apply")
+			}
+
+			g := parseTestGraph(t)
+			removed := approval.Apply(request, g)
+
+			if !reflect.DeepEqual(removed, test.removed) {
+				t.Errorf("expected removed %v, got %v", test.removed, removed)
+			}
+			if versions := g.Versions(); !reflect.DeepEqual(versions, test.nodes) {
+				t.Errorf("expected nodes %v, got %v", test.nodes, versions)
+			}
+		})
+	}
+}
+
+func TestApprovalPending(t *testing.T) {
+	state := newTestState(t)
+	state.RecordFirstSeen("stable-4.14", []string{"4.14.1"}, time.Now())
+	approval := NewApproval("test", true, state, newTestMetrics())
+
+	approval.Apply(Request{Arch: "amd64", Channel: "stable-4.14", Version: "4.14.1"}, parseTestGraph(t))
+
+	// both releases were first seen at the same time, so their order is undefined
+	versions := make(map[string]bool)
+	for _, release := range approval.Pending() {
+		versions[release.Version] = true
+	}
+	if !reflect.DeepEqual(versions, map[string]bool{"4.14.2": true, "4.14.3": true}) {
+		t.Fatalf("unexpected pending releases %v", versions)
+	}
+
+	err := approval.Decide(Decision{Channel: "stable-4.14", Version: "4.14.2", Decision: DECISION_APPROVED, Time: time.Now()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = approval.Decide(Decision{Version: "4.14.3", Decision: DECISION_REJECTED, Time: time.Now().Add(time.Second)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pending := approval.Pending(); len(pending) != 0 {
+		t.Errorf("expected no pending releases, got %+v", pending)
+	}
+
+	decisions := approval.Decisions()
+	if len(decisions) != 2 || decisions[0].Version != "4.14.3" {
+		t.Errorf("expected latest decision first, got %+v", decisions)
+	}
+
+	// revoking a decision makes the release pending again
+	err = approval.Revoke("stable-4.14", "4.14.2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pending := approval.Pending(); len(pending) != 1 || pending[0].Version != "4.14.2" {
+		t.Errorf("expected revoked release to be pending, got %+v", pending)
+	}
+}
+
+func TestApprovalInvalidDecision(t *testing.T) {
+	approval := NewApproval("test", true, newTestState(t), newTestMetrics())
+
+	tests := []struct {
+		name     string
+		decision Decision
+	}{
+		{name: "unknown decision", decision: Decision{Version: "4.14.2", Decision: "maybe"}},
+		{name: "invalid version", decision: Decision{Version: "latest", Decision: DECISION_APPROVED}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := approval.Decide(test.decision); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+	if decisions := approval.Decisions(); len(decisions) != 0 {
+		t.Errorf("invalid decisions were stored: %+v", decisions)
+	}
+}
@@ -0,0 +1,56 @@
+package policy
+
+import (
+	"github.com/lukeelten/openshift-update-proxy/pkg/graph"
+)
+
+const POLICY_BLOCKLIST = "blocklist"
+
+// Blocklist removes releases matching any of its constraints from the graph. The release the requesting
+// cluster is running is kept, so the cluster can still update away from it.
+type Blocklist struct {
+	constraints []*Constraint
+}
+
+var _ Filter = &Blocklist{}
+
+func NewBlocklist(entries []string) (*Blocklist, error) {
+	blocklist := &Blocklist{}
+	for _, entry := range entries {
+		constraint, err := ParseConstraint(entry)
+		if err != nil {
+			return nil, err
+		}
+		blocklist.constraints = append(blocklist.constraints, constraint)
+	}
+	return blocklist, nil
+}
+
+func (blocklist *Blocklist) Name() string {
+	return POLICY_BLOCKLIST
+}
+
+func (blocklist *Blocklist) Applies(request Request) bool {
+	return len(blocklist.constraints) > 0
+}
+
+func (blocklist *Blocklist) Apply(request Request, g *graph.Graph) []string {
+	return g.RemoveNodes(func(node graph.Node) bool {
+		return node.Version != request.Version && blocklist.Blocked(node.Version)
+	})
+}
+
+// Blocked returns true if the version matches any entry of the blocklist
+func (blocklist *Blocklist) Blocked(version string) bool {
+	parsed, err := ParseVersion(version)
+	if err != nil {
+		return false
+	}
+
+	for _, constraint := range blocklist.constraints {
+		if constraint.Matches(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package policy
+
+import (
+	"github.com/lukeelten/openshift-update-proxy/pkg/graph"
+	"reflect"
+	"testing"
+)
+
+const testGraph = `{
+	"nodes": [
+		{"version": "4.14.1", "payload": "a"},
+		{"version": "4.14.2", "payload": "b"},
+		{"version": "4.14.3", "payload": "c"}
+	],
+	"edges": [[0, 1], [0, 2], [1, 2]],
+	"conditionalEdges": [
+		{
+			"edges": [{"from": "4.14.1", "to": "4.14.2"}],
+			"risks": [{"url": "u", "name": "A", "message": "m", "matchingRules": [{"type": "Always"}]}]
+		},
+		{
+			"edges": [{"from": "4.14.1", "to": "4.14.3"}, {"from": "4.14.2", "to": "4.14.3"}],
+			"risks": [{"url": "u", "name": "B", "message": "m", "matchingRules": [{"type": "Always"}]}]
+		}
+	]
+}`
+
+func parseTestGraph(t *testing.T) *graph.Graph {
+	t.Helper()
+
+	g, err := graph.Parse([]byte(testGraph))
+	if err != nil {
+		t.Fatalf("cannot parse test graph: %v", err)
+	}
+	return g
+}
+
+func TestBlocklistApply(t *testing.T) {
+	tests := []struct {
+		name        string
+		blocklist   []string
+		version     string
+		removed     []string
+		nodes       []string
+		edges       []graph.Edge
+		conditional [][]graph.ConditionalUpdate
+	}{
+		{
+			name:      "block middle release",
+			blocklist: []string{"4.14.2"},
+			version:   "4.14.1",
+			removed:   []string{"4.14.2"},
+			nodes:     []string{"4.14.1", "4.14.3"},
+			edges:     []graph.Edge{{From: 0, To: 1}},
+			conditional: [][]graph.ConditionalUpdate{
+				{{From: "4.14.1", To: "4.14.3"}},
+			},
+		},
+		{
+			name:      "keep running release",
+			blocklist: []string{"4.14.1"},
+			version:   "4.14.1",
+			removed:   []string{},
+			nodes:     []string{"4.14.1", "4.14.2", "4.14.3"},
+			edges:     []graph.Edge{{From: 0, To: 1}, {From: 0, To: 2}, {From: 1, To: 2}},
+			conditional: [][]graph.ConditionalUpdate{
+				{{From: "4.14.1", To: "4.14.2"}},
+				{{From: "4.14.1", To: "4.14.3"}, {From: "4.14.2", To: "4.14.3"}},
+			},
+		},
+		{
+			name:        "block range",
+			blocklist:   []string{">=4.14.2"},
+			version:     "4.14.1",
+			removed:     []string{"4.14.2", "4.14.3"},
+			nodes:       []string{"4.14.1"},
+			edges:       []graph.Edge{},
+			conditional: [][]graph.ConditionalUpdate{},
+		},
+		{
+			name:      "no match",
+			blocklist: []string{"4.13.x"},
+			version:   "4.14.1",
+			removed:   []string{},
+			nodes:     []string{"4.14.1", "4.14.2", "4.14.3"},
+			edges:     []graph.Edge{{From: 0, To: 1}, {From: 0, To: 2}, {From: 1, To: 2}},
+			conditional: [][]graph.ConditionalUpdate{
+				{{From: "4.14.1", To: "4.14.2"}},
+				{{From: "4.14.1", To: "4.14.3"}, {From: "4.14.2", To: "4.14.3"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blocklist, err := NewBlocklist(test.blocklist)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			g := parseTestGraph(t)
+			removed := blocklist.Apply(Request{Arch: "amd64", Channel: "stable-4.14", Version: test.version}, g)
+
+			if !reflect.DeepEqual(removed, test.removed) {
+				t.Errorf("expected removed %v, got %v", test.removed, removed)
+			}
+			if versions := g.Versions(); !reflect.DeepEqual(versions, test.nodes) {
+				t.Errorf("expected nodes %v, got %v", test.nodes, versions)
+			}
+			if !reflect.DeepEqual(g.Edges, test.edges) {
+				t.Errorf("expected edges %v, got %v", test.edges, g.Edges)
+			}
+
+			if len(g.ConditionalEdges) != len(test.conditional) {
+				t.Fatalf("expected %d conditional edges, got %+v", len(test.conditional), g.ConditionalEdges)
+			}
+			for i, updates := range test.conditional {
+				if !reflect.DeepEqual(g.ConditionalEdges[i].Edges, updates) {
+					t.Errorf("expected conditional updates %+v, got %+v", updates, g.ConditionalEdges[i].Edges)
+				}
+			}
+
+			if err := g.Validate(); err != nil {
+				t.Errorf("filtered graph is invalid: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewBlocklistInvalid(t *testing.T) {
+	_, err := NewBlocklist([]string{"4.14.1", "not a version"})
+	if err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,170 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Constraint matches versions against a version or range expression. Supported are exact versions (4.14.3),
+// wildcards (4.14, 4.14.x, *), comparisons (>=4.14.0, <4.15) and combinations: comparators separated by
+// spaces or commas must all match, alternatives are separated by ||.
+//
+// Comparisons against partial versions only consider the given components, so <=4.14 matches all 4.14.z releases.
+type Constraint struct {
+	raw  string
+	sets [][]comparator
+}
+
+type comparator struct {
+	op      string
+	version Version
+	// number of version components given, 0 for a wildcard
+	components int
+}
+
+var operators = []string{">=", "<=", "!=", "==", ">", "<", "="}
+
+func ParseConstraint(value string) (*Constraint, error) {
+	constraint := &Constraint{raw: value}
+
+	for _, alternative := range strings.Split(value, "||") {
+		var set []comparator
+		var op string
+
+		for _, token := range strings.FieldsFunc(alternative, func(r rune) bool { return r == ' ' || r == ',' || r == '\t' }) {
+			tokenOp := operator(token)
+			if tokenOp == token {
+				// operator separated from its version by a space
+				op = tokenOp
+				continue
+			}
+			if len(op) > 0 && len(tokenOp) > 0 {
+				return nil, fmt.Errorf("invalid constraint %q: duplicate operator", value)
+			}
+			if len(tokenOp) > 0 {
+				op = tokenOp
+			}
+
+			c, err := parseComparator(op, strings.TrimPrefix(token, tokenOp))
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint %q: %w", value, err)
+			}
+			set = append(set, c)
+			op = ""
+		}
+
+		if len(op) > 0 || len(set) == 0 {
+			return nil, fmt.Errorf("invalid constraint %q: missing version", value)
+		}
+		constraint.sets = append(constraint.sets, set)
+	}
+
+	return constraint, nil
+}
+
+func operator(token string) string {
+	for _, op := range operators {
+		if strings.HasPrefix(token, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func parseComparator(op, value string) (comparator, error) {
+	if op == "==" || len(op) == 0 {
+		op = "="
+	}
+
+	parts, pre, err := splitVersion(value)
+	if err != nil {
+		return comparator{}, err
+	}
+
+	c := comparator{op: op, version: Version{Pre: pre}}
+	numbers := []*uint64{&c.version.Major, &c.version.Minor, &c.version.Patch}
+
+	for i, part := range parts {
+		if i >= len(numbers) {
+			return comparator{}, fmt.Errorf("too many components in %q", value)
+		}
+		if part == "x" || part == "X" || part == "*" {
+			if i+1 != len(parts) {
+				return comparator{}, fmt.Errorf("wildcard must be the last component in %q", value)
+			}
+			break
+		}
+
+		*numbers[i], err = strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return comparator{}, fmt.Errorf("invalid version %q: %w", value, err)
+		}
+		c.components++
+	}
+
+	if len(pre) > 0 && c.components != 3 {
+		return comparator{}, fmt.Errorf("pre-release requires a full version in %q", value)
+	}
+
+	return c, nil
+}
+
+func (constraint *Constraint) String() string {
+	return constraint.raw
+}
+
+// Matches returns true if the version satisfies the constraint
+func (constraint *Constraint) Matches(version Version) bool {
+	for _, set := range constraint.sets {
+		matches := true
+		for _, c := range set {
+			if !c.matches(version) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesString parses the version and checks it against the constraint. Unparsable versions never match.
+func (constraint *Constraint) MatchesString(version string) bool {
+	parsed, err := ParseVersion(version)
+	if err != nil {
+		return false
+	}
+	return constraint.Matches(parsed)
+}
+
+func (c comparator) matches(version Version) bool {
+	if c.components == 0 {
+		return c.op != "!="
+	}
+
+	var result int
+	if c.components == 3 {
+		result = version.Compare(c.version)
+	} else {
+		result = compareCore(version, c.version, c.components)
+	}
+
+	switch c.op {
+	case "=":
+		return result == 0
+	case "!=":
+		return result != 0
+	case ">":
+		return result > 0
+	case ">=":
+		return result >= 0
+	case "<":
+		return result < 0
+	case "<=":
+		return result <= 0
+	}
+	return false
+}
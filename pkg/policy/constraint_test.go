@@ -0,0 +1,88 @@
+package policy
+
+import (
+	"testing"
+)
+
+func TestParseConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		valid      bool
+	}{
+		{constraint: "4.14.3", valid: true},
+		{constraint: "4.14", valid: true},
+		{constraint: "4.14.x", valid: true},
+		{constraint: "*", valid: true},
+		{constraint: ">=4.14.0 <4.14.5", valid: true},
+		{constraint: ">= 4.14.0, < 4.14.5", valid: true},
+		{constraint: "4.13.x || 4.15.1", valid: true},
+		{constraint: "==4.14.1", valid: true},
+		{constraint: "4.15.0-rc.1", valid: true},
+		{constraint: "", valid: false},
+		{constraint: ">=", valid: false},
+		{constraint: ">=>=4.14", valid: false},
+		{constraint: "4.14 ||", valid: false},
+		{constraint: "4.x.1", valid: false},
+		{constraint: "a.b", valid: false},
+		{constraint: "4.14.0.1", valid: false},
+		{constraint: "4.14-rc.1", valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.constraint, func(t *testing.T) {
+			constraint, err := ParseConstraint(test.constraint)
+			if test.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Errorf("expected error, got %v", constraint)
+			}
+		})
+	}
+}
+
+func TestConstraintMatches(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		matches    bool
+	}{
+		{constraint: "4.14.3", version: "4.14.3", matches: true},
+		{constraint: "4.14.3", version: "4.14.4", matches: false},
+		{constraint: "==4.14.3", version: "4.14.3", matches: true},
+		{constraint: "4.14", version: "4.14.9", matches: true},
+		{constraint: "4.14", version: "4.15.0", matches: false},
+		{constraint: "4.14.x", version: "4.14.0", matches: true},
+		{constraint: "4.14.x", version: "4.15.0", matches: false},
+		{constraint: "*", version: "1.0.0", matches: true},
+		{constraint: ">=4.14.0 <4.14.5", version: "4.14.4", matches: true},
+		{constraint: ">=4.14.0 <4.14.5", version: "4.14.5", matches: false},
+		{constraint: ">= 4.14.0, < 4.14.5", version: "4.14.0", matches: true},
+		{constraint: "<=4.14", version: "4.14.99", matches: true},
+		{constraint: ">4.14", version: "4.14.99", matches: false},
+		{constraint: ">4.14", version: "4.15.0", matches: true},
+		{constraint: "!=4.14", version: "4.14.2", matches: false},
+		{constraint: "!=4.14", version: "4.15.2", matches: true},
+		{constraint: "4.13.x || 4.15.1", version: "4.13.7", matches: true},
+		{constraint: "4.13.x || 4.15.1", version: "4.15.1", matches: true},
+		{constraint: "4.13.x || 4.15.1", version: "4.14.1", matches: false},
+		{constraint: "<4.14.0", version: "4.14.0-rc.1", matches: true},
+		{constraint: "4.15.0-rc.1", version: "4.15.0-rc.1", matches: true},
+		{constraint: "4.15.0-rc.1", version: "4.15.0", matches: false},
+		{constraint: "4.15.0-0.okd-2024-01-27-070424", version: "4.15.0-0.okd-2024-01-27-070424", matches: true},
+		{constraint: "*", version: "invalid", matches: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.constraint+" "+test.version, func(t *testing.T) {
+			constraint, err := ParseConstraint(test.constraint)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if matches := constraint.MatchesString(test.version); matches != test.matches {
+				t.Errorf("expected %v, got %v", test.matches, matches)
+			}
+		})
+	}
+}
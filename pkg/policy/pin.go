@@ -0,0 +1,148 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lukeelten/openshift-update-proxy/pkg/config"
+	"github.com/lukeelten/openshift-update-proxy/pkg/graph"
+	"strings"
+)
+
+const (
+	POLICY_PIN = "pin"
+
+	PIN_SOURCE_CONFIG  = "config"
+	PIN_SOURCE_RUNTIME = "runtime"
+)
+
+// VersionPin removes releases outside the minimum and maximum version of the channel. Pins set at runtime
+// take precedence over the configured ones. The release the requesting cluster is running is kept.
+type VersionPin struct {
+	configured map[string]ChannelPin
+	state      *State
+}
+
+var _ Filter = &VersionPin{}
+
+func NewVersionPin(channels map[string]config.ChannelPolicyConfig, state *State) (*VersionPin, error) {
+	pin := &VersionPin{
+		configured: make(map[string]ChannelPin, len(channels)),
+		state:      state,
+	}
+
+	for channel, cfg := range channels {
+		channelPin := ChannelPin{MinVersion: cfg.MinVersion, MaxVersion: cfg.MaxVersion}
+		if _, _, err := channelPin.constraints(); err != nil {
+			return nil, err
+		}
+		pin.configured[channel] = channelPin
+	}
+
+	return pin, nil
+}
+
+func (pin *VersionPin) Name() string {
+	return POLICY_PIN
+}
+
+func (pin *VersionPin) Applies(request Request) bool {
+	_, _, ok := pin.Get(request.Channel)
+	return ok
+}
+
+func (pin *VersionPin) Apply(request Request, g *graph.Graph) []string {
+	channelPin, _, ok := pin.Get(request.Channel)
+	if !ok {
+		return nil
+	}
+
+	min, max, err := channelPin.constraints()
+	if err != nil {
+		// pins are validated when they are set
+		return nil
+	}
+
+	return g.RemoveNodes(func(node graph.Node) bool {
+		if node.Version == request.Version {
+			return false
+		}
+		version, err := ParseVersion(node.Version)
+		if err != nil {
+			return false
+		}
+		return (min != nil && !min.Matches(version)) || (max != nil && !max.Matches(version))
+	})
+}
+
+// Get returns the effective pin of the channel and its source
+func (pin *VersionPin) Get(channel string) (ChannelPin, string, bool) {
+	if channelPin, ok := pin.state.Pin(channel); ok {
+		return channelPin, PIN_SOURCE_RUNTIME, true
+	}
+	if channelPin, ok := pin.configured[channel]; ok {
+		return channelPin, PIN_SOURCE_CONFIG, true
+	}
+	return ChannelPin{}, "", false
+}
+
+// Set validates and stores a runtime pin for the channel
+func (pin *VersionPin) Set(channel string, channelPin ChannelPin) error {
+	if _, _, err := channelPin.constraints(); err != nil {
+		return err
+	}
+	return pin.state.SetPin(channel, channelPin)
+}
+
+// Delete removes the runtime pin of the channel, the configured pin applies again
+func (pin *VersionPin) Delete(channel string) error {
+	return pin.state.DeletePin(channel)
+}
+
+// List returns the effective pins of all channels
+func (pin *VersionPin) List() map[string]PinInfo {
+	pins := make(map[string]PinInfo)
+	for channel, channelPin := range pin.configured {
+		pins[channel] = PinInfo{ChannelPin: channelPin, Source: PIN_SOURCE_CONFIG}
+	}
+	for channel, channelPin := range pin.state.Pins() {
+		pins[channel] = PinInfo{ChannelPin: channelPin, Source: PIN_SOURCE_RUNTIME}
+	}
+	return pins
+}
+
+type PinInfo struct {
+	ChannelPin
+	Source string `json:"source"`
+}
+
+// constraints parses the bounds of the pin, nil if a bound is not set
+func (channelPin ChannelPin) constraints() (*Constraint, *Constraint, error) {
+	if len(channelPin.MinVersion) == 0 && len(channelPin.MaxVersion) == 0 {
+		return nil, nil, errors.New("pin needs a minimum or maximum version")
+	}
+
+	var min, max *Constraint
+	var err error
+	if len(channelPin.MinVersion) > 0 {
+		min, err = boundConstraint(">=", channelPin.MinVersion)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(channelPin.MaxVersion) > 0 {
+		max, err = boundConstraint("<=", channelPin.MaxVersion)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return min, max, nil
+}
+
+// boundConstraint creates a constraint from a single version, so a bound cannot smuggle in a range expression
+func boundConstraint(op, version string) (*Constraint, error) {
+	c, err := parseComparator(op, strings.TrimSpace(version))
+	if err != nil {
+		return nil, fmt.Errorf("invalid version bound %q: %w", version, err)
+	}
+	return &Constraint{raw: op + version, sets: [][]comparator{{c}}}, nil
+}
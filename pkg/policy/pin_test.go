@@ -0,0 +1,198 @@
+package policy
+
+import (
+	"github.com/lukeelten/openshift-update-proxy/pkg/config"
+	"github.com/lukeelten/openshift-update-proxy/pkg/graph"
+	"go.uber.org/zap"
+	"reflect"
+	"testing"
+)
+
+func newTestVersionPin(t *testing.T, channels map[string]config.ChannelPolicyConfig) *VersionPin {
+	t.Helper()
+
+	state, err := NewState(t.TempDir(), "test", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pin, err := NewVersionPin(channels, state)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return pin
+}
+
+func TestVersionPinApply(t *testing.T) {
+	tests := []struct {
+		name        string
+		pin         config.ChannelPolicyConfig
+		version     string
+		removed     []string
+		nodes       []string
+		edges       []graph.Edge
+		conditional [][]graph.ConditionalUpdate
+	}{
+		{
+			name:    "minimum version",
+			pin:     config.ChannelPolicyConfig{MinVersion: "4.14.2"},
+			version: "4.14.2",
+			removed: []string{"4.14.1"},
+			nodes:   []string{"4.14.2", "4.14.3"},
+			edges:   []graph.Edge{{From: 0, To: 1}},
+			conditional: [][]graph.ConditionalUpdate{
+				{{From: "4.14.2", To: "4.14.3"}},
+			},
+		},
+		{
+			name:        "maximum version",
+			pin:         config.ChannelPolicyConfig{MaxVersion: "4.14.2"},
+			version:     "4.14.1",
+			removed:     []string{"4.14.3"},
+			nodes:       []string{"4.14.1", "4.14.2"},
+			edges:       []graph.Edge{{From: 0, To: 1}},
+			conditional: [][]graph.ConditionalUpdate{{{From: "4.14.1", To: "4.14.2"}}},
+		},
+		{
+			name:        "minimum and maximum version",
+			pin:         config.ChannelPolicyConfig{MinVersion: "4.14.2", MaxVersion: "4.14.2"},
+			version:     "4.14.2",
+			removed:     []string{"4.14.1", "4.14.3"},
+			nodes:       []string{"4.14.2"},
+			edges:       []graph.Edge{},
+			conditional: [][]graph.ConditionalUpdate{},
+		},
+		{
+			name:    "partial maximum includes all z-stream releases",
+			pin:     config.ChannelPolicyConfig{MaxVersion: "4.14"},
+			version: "4.14.1",
+			removed: []string{},
+			nodes:   []string{"4.14.1", "4.14.2", "4.14.3"},
+			edges:   []graph.Edge{{From: 0, To: 1}, {From: 0, To: 2}, {From: 1, To: 2}},
+			conditional: [][]graph.ConditionalUpdate{
+				{{From: "4.14.1", To: "4.14.2"}},
+				{{From: "4.14.1", To: "4.14.3"}, {From: "4.14.2", To: "4.14.3"}},
+			},
+		},
+		{
+			name:    "running version outside the pin is kept",
+			pin:     config.ChannelPolicyConfig{MinVersion: "4.14.2"},
+			version: "4.14.1",
+			removed: []string{},
+			nodes:   []string{"4.14.1", "4.14.2", "4.14.3"},
+			edges:   []graph.Edge{{From: 0, To: 1}, {From: 0, To: 2}, {From: 1, To: 2}},
+			conditional: [][]graph.ConditionalUpdate{
+				{{From: "4.14.1", To: "4.14.2"}},
+				{{From: "4.14.1", To: "4.14.3"}, {From: "4.14.2", To: "4.14.3"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pin := newTestVersionPin(t, map[string]config.ChannelPolicyConfig{"stable-4.14": test.pin})
+			request := Request{Arch: "amd64", Channel: "stable-4.14", Version: test.version}
+			if !pin.Applies(request) {
+				t.Fatal("pin does not apply to its channel")
+			}
+
+			g := parseTestGraph(t)
+			removed := pin.Apply(request, g)
+
+			if !reflect.DeepEqual(removed, test.removed) {
+				t.Errorf("expected removed %v, got %v", test.removed, removed)
+			}
+			if versions := g.Versions(); !reflect.DeepEqual(versions, test.nodes) {
+				t.Errorf("expected nodes %v, got %v", test.nodes, versions)
+			}
+			if !reflect.DeepEqual(g.Edges, test.edges) {
+				t.Errorf("expected edges %v, got %v", test.edges, g.Edges)
+			}
+			if len(g.ConditionalEdges) != len(test.conditional) {
+				t.Fatalf("expected %d conditional edges, got %+v", len(test.conditional), g.ConditionalEdges)
+			}
+			for i, updates := range test.conditional {
+				if !reflect.DeepEqual(g.ConditionalEdges[i].Edges, updates) {
+					t.Errorf("expected conditional updates %+v, got %+v", updates, g.ConditionalEdges[i].Edges)
+				}
+			}
+		})
+	}
+}
+
+func TestVersionPinOtherChannel(t *testing.T) {
+	pin := newTestVersionPin(t, map[string]config.ChannelPolicyConfig{"stable-4.14": {MinVersion: "4.14.2"}})
+
+	if pin.Applies(Request{Arch: "amd64", Channel: "fast-4.14", Version: "4.14.1"}) {
+		t.Error("pin applies to other channel")
+	}
+	if removed := pin.Apply(Request{Arch: "amd64", Channel: "fast-4.14", Version: "4.14.1"}, parseTestGraph(t)); len(removed) != 0 {
+		t.Errorf("pin removed versions of other channel: %v", removed)
+	}
+}
+
+func TestVersionPinRuntime(t *testing.T) {
+	pin := newTestVersionPin(t, map[string]config.ChannelPolicyConfig{"stable-4.14": {MinVersion: "4.14.2"}})
+
+	if _, source, _ := pin.Get("stable-4.14"); source != PIN_SOURCE_CONFIG {
+		t.Errorf("expected configured pin, got %s", source)
+	}
+
+	err := pin.Set("stable-4.14", ChannelPin{MaxVersion: "4.14.1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	channelPin, source, ok := pin.Get("stable-4.14")
+	if !ok || source != PIN_SOURCE_RUNTIME || channelPin.MaxVersion != "4.14.1" || channelPin.MinVersion != "" {
+		t.Errorf("runtime pin does not take precedence: %+v from %s", channelPin, source)
+	}
+
+	g := parseTestGraph(t)
+	if removed := pin.Apply(Request{Arch: "amd64", Channel: "stable-4.14", Version: "4.14.1"}, g); !reflect.DeepEqual(removed, []string{"4.14.2", "4.14.3"}) {
+		t.Errorf("runtime pin not applied, removed %v", removed)
+	}
+
+	if list := pin.List(); len(list) != 1 || list["stable-4.14"].Source != PIN_SOURCE_RUNTIME {
+		t.Errorf("unexpected pins %+v", list)
+	}
+
+	err = pin.Delete("stable-4.14")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, source, _ := pin.Get("stable-4.14"); source != PIN_SOURCE_CONFIG {
+		t.Errorf("configured pin does not apply again, got %s", source)
+	}
+}
+
+func TestVersionPinInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		pin  ChannelPin
+	}{
+		{name: "no bounds", pin: ChannelPin{}},
+		{name: "invalid minimum", pin: ChannelPin{MinVersion: "latest"}},
+		{name: "invalid maximum", pin: ChannelPin{MaxVersion: "4.x.1"}},
+		{name: "range expression", pin: ChannelPin{MaxVersion: "4.14 || 5"}},
+		{name: "operator", pin: ChannelPin{MinVersion: "<4.14"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pin := newTestVersionPin(t, nil)
+			if err := pin.Set("stable-4.14", test.pin); err == nil {
+				t.Error("expected error")
+			}
+			if _, _, ok := pin.Get("stable-4.14"); ok {
+				t.Error("invalid pin was stored")
+			}
+
+			_, err := NewVersionPin(map[string]config.ChannelPolicyConfig{
+				"stable-4.14": {MinVersion: test.pin.MinVersion, MaxVersion: test.pin.MaxVersion},
+			}, nil)
+			if err == nil {
+				t.Error("expected error for configured pin")
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/lukeelten/openshift-update-proxy/pkg/config"
+	"github.com/lukeelten/openshift-update-proxy/pkg/graph"
+	"github.com/lukeelten/openshift-update-proxy/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// Request identifies the graph request a policy is applied to
+type Request struct {
+	Arch    string
+	Channel string
+	// Version the requesting cluster is running
+	Version string
+}
+
+// Filter removes releases from a graph
+type Filter interface {
+	Name() string
+	// Applies returns false if the filter would not change any graph of the request, so the graph is not parsed
+	Applies(request Request) bool
+	// Apply modifies the graph and returns the versions which are no longer reachable
+	Apply(request Request, g *graph.Graph) []string
+}
+
+// UpstreamPolicy rewrites the graphs of an upstream before they are served
+type UpstreamPolicy struct {
+	name    string
+	logger  *zap.SugaredLogger
+	metrics *metrics.UpdateProxyMetrics
+
+	filters []Filter
+
+	pins     *VersionPin
+	soak     *Soak
+	approval *Approval
+}
+
+// NewUpstreamPolicy creates the policy of an upstream. Changes made at runtime are stored in stateDirectory.
+// A soak period and the approval workflow require stateDirectory, as they depend on when releases were first seen
+// and approvals must survive a restart.
+func NewUpstreamPolicy(cfg config.UpstreamConfig, stateDirectory string, m *metrics.UpdateProxyMetrics, logger *zap.SugaredLogger) (*UpstreamPolicy, error) {
+	if cfg.Policy.SoakPeriod > 0 && len(stateDirectory) == 0 {
+		return nil, fmt.Errorf("upstream %s: soakPeriod requires stateDirectory", cfg.Name)
+	}
+	if cfg.Policy.RequireApproval && len(stateDirectory) == 0 {
+		return nil, fmt.Errorf("upstream %s: requireApproval requires stateDirectory", cfg.Name)
+	}
+
+	logger = logger.With("upstream", cfg.Name)
+	policy := &UpstreamPolicy{
+		name:    cfg.Name,
+		logger:  logger,
+		metrics: m,
+	}
+
+	state, err := NewState(stateDirectory, cfg.Name, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// soak period and approval have to see the complete graph to record new releases, so they run before all
+	// filters which remove nodes
+	policy.soak = NewSoak(cfg.Name, cfg.Policy.SoakPeriod, state, m)
+	policy.approval = NewApproval(cfg.Name, cfg.Policy.RequireApproval, state, m)
+	policy.filters = append(policy.filters, policy.soak, policy.approval)
+
+	if len(cfg.Policy.Blocklist) > 0 {
+		blocklist, err := NewBlocklist(cfg.Policy.Blocklist)
+		if err != nil {
+			return nil, err
+		}
+		policy.filters = append(policy.filters, blocklist)
+	}
+
+	policy.pins, err = NewVersionPin(cfg.Policy.Channels, state)
+	if err != nil {
+		return nil, err
+	}
+	policy.filters = append(policy.filters, policy.pins)
+
+	return policy, nil
+}
+
+func (policy *UpstreamPolicy) Name() string {
+	return policy.name
+}
+
+// Soak returns the soak period policy of the upstream
+func (policy *UpstreamPolicy) Soak() *Soak {
+	return policy.soak
+}
+
+// Approval returns the approval workflow of the upstream
+func (policy *UpstreamPolicy) Approval() *Approval {
+	return policy.approval
+}
+
+// Pins returns the version pins of the upstream, which can be changed at runtime
+func (policy *UpstreamPolicy) Pins() *VersionPin {
+	return policy.pins
+}
+
+// Apply rewrites the graph according to all filters. The body is returned unchanged if no filter applies.
+func (policy *UpstreamPolicy) Apply(request Request, body []byte) ([]byte, error) {
+	filters := make([]Filter, 0, len(policy.filters))
+	for _, filter := range policy.filters {
+		if filter.Applies(request) {
+			filters = append(filters, filter)
+		}
+	}
+
+	if len(filters) == 0 {
+		return body, nil
+	}
+
+	g, err := graph.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := false
+	for _, filter := range filters {
+		removed := filter.Apply(request, g)
+		if len(removed) == 0 {
+			continue
+		}
+
+		changed = true
+		policy.logger.Debugw("policy removed versions from graph", "policy", filter.Name(), "channel", request.Channel, "versions", removed)
+		policy.metrics.PolicyRemovedVersions.WithLabelValues(policy.name, filter.Name()).Add(float64(len(removed)))
+	}
+
+	if !changed {
+		return body, nil
+	}
+
+	return g.Marshal()
+}
@@ -0,0 +1,43 @@
+package policy
+
+import (
+	"github.com/lukeelten/openshift-update-proxy/pkg/config"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestNewUpstreamPolicyStateDirectory(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         config.PolicyConfig
+		stateDirectory bool
+		valid          bool
+	}{
+		{name: "no policy", valid: true},
+		{name: "blocklist without state", policy: config.PolicyConfig{Blocklist: []string{"4.14.1"}}, valid: true},
+		{name: "soak period with state", policy: config.PolicyConfig{SoakPeriod: time.Hour}, stateDirectory: true, valid: true},
+		{name: "soak period without state", policy: config.PolicyConfig{SoakPeriod: time.Hour}, valid: false},
+		{name: "approval with state", policy: config.PolicyConfig{RequireApproval: true}, stateDirectory: true, valid: true},
+		{name: "approval without state", policy: config.PolicyConfig{RequireApproval: true}, valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := config.UpstreamConfig{Name: "test", Policy: test.policy}
+
+			stateDirectory := ""
+			if test.stateDirectory {
+				stateDirectory = t.TempDir()
+			}
+
+			_, err := NewUpstreamPolicy(cfg, stateDirectory, nil, zap.NewNop().Sugar())
+			if test.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"github.com/lukeelten/openshift-update-proxy/pkg/graph"
+	"github.com/lukeelten/openshift-update-proxy/pkg/metrics"
+	"sort"
+	"time"
+)
+
+const POLICY_SOAK = "soak"
+
+// Soak hides updates to releases until they have been in the graph of the channel for the soak period.
+// The releases stay in the graph, so clusters already running them still get their updates.
+type Soak struct {
+	upstream string
+	period   time.Duration
+	state    *State
+	metrics  *metrics.UpdateProxyMetrics
+}
+
+// HeldRelease is a release whose updates are hidden until VisibleAt
+type HeldRelease struct {
+	Channel   string    `json:"channel"`
+	Version   string    `json:"version"`
+	FirstSeen time.Time `json:"firstSeen"`
+	VisibleAt time.Time `json:"visibleAt"`
+}
+
+var _ Filter = &Soak{}
+
+func NewSoak(upstream string, period time.Duration, state *State, m *metrics.UpdateProxyMetrics) *Soak {
+	return &Soak{
+		upstream: upstream,
+		period:   period,
+		state:    state,
+		metrics:  m,
+	}
+}
+
+func (soak *Soak) Name() string {
+	return POLICY_SOAK
+}
+
+func (soak *Soak) Applies(request Request) bool {
+	return soak.period > 0
+}
+
+func (soak *Soak) Apply(request Request, g *graph.Graph) []string {
+	if len(g.Nodes) == 0 {
+		// unknown channel, nothing to record
+		return nil
+	}
+
+	now := time.Now()
+	firstSeen := soak.state.RecordFirstSeen(request.Channel, g.Versions(), now)
+	soak.updateMetrics(request.Channel, now)
+
+	return g.RemoveEdgesTo(func(node graph.Node) bool {
+		return now.Before(firstSeen[node.Version].Add(soak.period))
+	})
+}
+
+// Held returns all releases which are currently held back, ordered by the time they become visible
+func (soak *Soak) Held() []HeldRelease {
+	held := make([]HeldRelease, 0)
+	if soak.period <= 0 {
+		return held
+	}
+
+	now := time.Now()
+	for channel, seen := range soak.state.FirstSeen() {
+		held = append(held, soak.held(channel, seen, now)...)
+	}
+
+	sort.Slice(held, func(i, j int) bool {
+		return held[i].VisibleAt.Before(held[j].VisibleAt)
+	})
+	return held
+}
+
+func (soak *Soak) held(channel string, seen map[string]time.Time, now time.Time) []HeldRelease {
+	held := make([]HeldRelease, 0)
+	for version, firstSeen := range seen {
+		visibleAt := firstSeen.Add(soak.period)
+		if now.Before(visibleAt) {
+			held = append(held, HeldRelease{
+				Channel:   channel,
+				Version:   version,
+				FirstSeen: firstSeen,
+				VisibleAt: visibleAt,
+			})
+		}
+	}
+	return held
+}
+
+// updateMetrics exports the time held back releases of the channel become visible and removes released ones
+func (soak *Soak) updateMetrics(channel string, now time.Time) {
+	seen := soak.state.ChannelFirstSeen(channel)
+	for version, firstSeen := range seen {
+		visibleAt := firstSeen.Add(soak.period)
+		if now.Before(visibleAt) {
+			soak.metrics.PolicyHeldReleases.WithLabelValues(soak.upstream, channel, version).Set(float64(visibleAt.Unix()))
+		} else {
+			soak.metrics.PolicyHeldReleases.DeleteLabelValues(soak.upstream, channel, version)
+		}
+	}
+}
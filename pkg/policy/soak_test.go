@@ -0,0 +1,187 @@
+package policy
+
+import (
+	"github.com/lukeelten/openshift-update-proxy/pkg/config"
+	"github.com/lukeelten/openshift-update-proxy/pkg/graph"
+	"github.com/lukeelten/openshift-update-proxy/pkg/metrics"
+	"go.uber.org/zap"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testMetricsOnce sync.Once
+	testMetrics     *metrics.UpdateProxyMetrics
+)
+
+// newTestMetrics returns the metrics shared by all tests, as metrics can only be registered once
+func newTestMetrics() *metrics.UpdateProxyMetrics {
+	testMetricsOnce.Do(func() {
+		testMetrics = metrics.NewUpdateProxyMetrics(&config.UpdateProxyConfig{})
+	})
+	return testMetrics
+}
+
+func newTestState(t *testing.T) *State {
+	t.Helper()
+
+	state, err := NewState(t.TempDir(), "test", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return state
+}
+
+func TestSoakApply(t *testing.T) {
+	tests := []struct {
+		name        string
+		seen        []string
+		version     string
+		removed     []string
+		edges       []graph.Edge
+		conditional [][]graph.ConditionalUpdate
+	}{
+		{
+			name:        "first sighting of channel",
+			seen:        nil,
+			version:     "4.14.1",
+			removed:     []string{},
+			edges:       []graph.Edge{{From: 0, To: 1}, {From: 0, To: 2}, {From: 1, To: 2}},
+			conditional: [][]graph.ConditionalUpdate{{{From: "4.14.1", To: "4.14.2"}}, {{From: "4.14.1", To: "4.14.3"}, {From: "4.14.2", To: "4.14.3"}}},
+		},
+		{
+			name:        "new release is held",
+			seen:        []string{"4.14.1", "4.14.2"},
+			version:     "4.14.1",
+			removed:     []string{"4.14.3"},
+			edges:       []graph.Edge{{From: 0, To: 1}},
+			conditional: [][]graph.ConditionalUpdate{{{From: "4.14.1", To: "4.14.2"}}},
+		},
+		{
+			name:        "new releases are held",
+			seen:        []string{"4.14.1"},
+			version:     "4.14.1",
+			removed:     []string{"4.14.2", "4.14.3"},
+			edges:       []graph.Edge{},
+			conditional: [][]graph.ConditionalUpdate{},
+		},
+		{
+			name:        "running held release keeps its updates",
+			seen:        []string{"4.14.1", "4.14.3"},
+			version:     "4.14.2",
+			removed:     []string{"4.14.2"},
+			edges:       []graph.Edge{{From: 0, To: 2}, {From: 1, To: 2}},
+			conditional: [][]graph.ConditionalUpdate{{{From: "4.14.1", To: "4.14.3"}, {From: "4.14.2", To: "4.14.3"}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := newTestState(t)
+			if len(test.seen) > 0 {
+				state.RecordFirstSeen("stable-4.14", test.seen, time.Now())
+			}
+			soak := NewSoak("test", time.Hour, state, newTestMetrics())
+
+			request := Request{Arch: "amd64", Channel: "stable-4.14", Version: test.version}
+			if !soak.Applies(request) {
+				t.Fatal("soak does not apply")
+			}
+
+			g := parseTestGraph(t)
+			removed := soak.Apply(request, g)
+
+			if !reflect.DeepEqual(removed, test.removed) {
+				t.Errorf("expected removed %v, got %v", test.removed, removed)
+			}
+			if versions := g.Versions(); !reflect.DeepEqual(versions, []string{"4.14.1", "4.14.2", "4.14.3"}) {
+				t.Errorf("expected all nodes to be kept, got %v", versions)
+			}
+			if !reflect.DeepEqual(g.Edges, test.edges) {
+				t.Errorf("expected edges %v, got %v", test.edges, g.Edges)
+			}
+			if len(g.ConditionalEdges) != len(test.conditional) {
+				t.Fatalf("expected %d conditional edges, got %+v", len(test.conditional), g.ConditionalEdges)
+			}
+			for i, updates := range test.conditional {
+				if !reflect.DeepEqual(g.ConditionalEdges[i].Edges, updates) {
+					t.Errorf("expected conditional updates %+v, got %+v", updates, g.ConditionalEdges[i].Edges)
+				}
+			}
+		})
+	}
+}
+
+func TestSoakFirstSighting(t *testing.T) {
+	state := newTestState(t)
+	soak := NewSoak("test", time.Hour, state, newTestMetrics())
+
+	// releases already published when the channel is first seen are not held
+	soak.Apply(Request{Arch: "amd64", Channel: "stable-4.14", Version: "4.14.1"}, parseTestGraph(t))
+	for version, firstSeen := range state.ChannelFirstSeen("stable-4.14") {
+		if !firstSeen.IsZero() {
+			t.Errorf("expected zero first seen time for %s, got %v", version, firstSeen)
+		}
+	}
+	if held := soak.Held(); len(held) != 0 {
+		t.Errorf("expected no held releases, got %+v", held)
+	}
+
+	// empty graphs of unknown channels are not recorded
+	if removed := soak.Apply(Request{Arch: "amd64", Channel: "unknown", Version: "4.14.1"}, &graph.Graph{}); len(removed) != 0 {
+		t.Errorf("unexpected removed versions %v", removed)
+	}
+	if _, ok := state.FirstSeen()["unknown"]; ok {
+		t.Error("recorded unknown channel")
+	}
+}
+
+func TestSoakPeriodOver(t *testing.T) {
+	state := newTestState(t)
+	state.RecordFirstSeen("stable-4.14", []string{"4.14.1"}, time.Now())
+	state.RecordFirstSeen("stable-4.14", []string{"4.14.1", "4.14.2"}, time.Now().Add(-2*time.Hour))
+	state.RecordFirstSeen("stable-4.14", []string{"4.14.1", "4.14.2", "4.14.3"}, time.Now())
+	soak := NewSoak("test", time.Hour, state, newTestMetrics())
+
+	removed := soak.Apply(Request{Arch: "amd64", Channel: "stable-4.14", Version: "4.14.1"}, parseTestGraph(t))
+	if !reflect.DeepEqual(removed, []string{"4.14.3"}) {
+		t.Errorf("expected only 4.14.3 to be held, got %v", removed)
+	}
+
+	held := soak.Held()
+	if len(held) != 1 || held[0].Version != "4.14.3" || held[0].Channel != "stable-4.14" {
+		t.Fatalf("unexpected held releases %+v", held)
+	}
+	if !held[0].VisibleAt.Equal(held[0].FirstSeen.Add(time.Hour)) {
+		t.Errorf("expected release to be visible after the soak period, got %+v", held[0])
+	}
+}
+
+func TestSoakDisabled(t *testing.T) {
+	soak := NewSoak("test", 0, newTestState(t), newTestMetrics())
+
+	if soak.Applies(Request{Arch: "amd64", Channel: "stable-4.14", Version: "4.14.1"}) {
+		t.Error("soak without period applies")
+	}
+	if held := soak.Held(); len(held) != 0 {
+		t.Errorf("expected no held releases, got %+v", held)
+	}
+}
+
+func TestSoakSharedAcrossArchitectures(t *testing.T) {
+	state := newTestState(t)
+	state.RecordFirstSeen("stable-4.14", []string{"4.14.1", "4.14.2"}, time.Now())
+	soak := NewSoak("test", time.Hour, state, newTestMetrics())
+
+	// the release is first seen in the graph of one architecture and held for all of them
+	soak.Apply(Request{Arch: "amd64", Channel: "stable-4.14", Version: "4.14.1"}, parseTestGraph(t))
+	removed := soak.Apply(Request{Arch: "arm64", Channel: "stable-4.14", Version: "4.14.1"}, parseTestGraph(t))
+	if !reflect.DeepEqual(removed, []string{"4.14.3"}) {
+		t.Errorf("expected 4.14.3 to be held for other architecture, got %v", removed)
+	}
+	if held := soak.Held(); len(held) != 1 {
+		t.Errorf("expected release to be held once for all architectures, got %+v", held)
+	}
+}
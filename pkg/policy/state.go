@@ -0,0 +1,280 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lukeelten/openshift-update-proxy/pkg/utils"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State holds the policy changes made at runtime for one upstream. If a directory is configured, the state is
+// written to <directory>/<upstream>.json on every change and restored on startup.
+type State struct {
+	file   string
+	logger *zap.SugaredLogger
+
+	lock sync.RWMutex
+	data stateData
+}
+
+type stateData struct {
+	Pins map[string]ChannelPin `json:"pins,omitempty"`
+	// FirstSeen records per channel when each version was first seen in the graph
+	FirstSeen map[string]map[string]time.Time `json:"firstSeen,omitempty"`
+	// Decisions are the approvals and rejections of releases by channel and version
+	Decisions map[string]Decision `json:"decisions,omitempty"`
+}
+
+// ChannelPin bounds the versions served in a channel
+type ChannelPin struct {
+	MinVersion string     `json:"minVersion,omitempty"`
+	MaxVersion string     `json:"maxVersion,omitempty"`
+	UpdatedBy  string     `json:"updatedBy,omitempty"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
+}
+
+func NewState(directory, upstream string, logger *zap.SugaredLogger) (*State, error) {
+	state := &State{
+		logger: logger,
+		data: stateData{
+			Pins:      make(map[string]ChannelPin),
+			FirstSeen: make(map[string]map[string]time.Time),
+			Decisions: make(map[string]Decision),
+		},
+	}
+
+	if len(directory) == 0 {
+		return state, nil
+	}
+
+	err := os.MkdirAll(directory, 0o750)
+	if err != nil {
+		return nil, err
+	}
+	state.file = filepath.Join(directory, upstream+".json")
+
+	data, err := os.ReadFile(state.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &state.data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse policy state %s: %w", state.file, err)
+	}
+	if state.data.Pins == nil {
+		state.data.Pins = make(map[string]ChannelPin)
+	}
+	if state.data.FirstSeen == nil {
+		state.data.FirstSeen = make(map[string]map[string]time.Time)
+	}
+	if state.data.Decisions == nil {
+		state.data.Decisions = make(map[string]Decision)
+	}
+
+	logger.Infow("restored policy state", "file", state.file, "pins", len(state.data.Pins), "channels", len(state.data.FirstSeen))
+	return state, nil
+}
+
+// Persistent returns true if changes survive a restart
+func (state *State) Persistent() bool {
+	return len(state.file) > 0
+}
+
+func (state *State) Pin(channel string) (ChannelPin, bool) {
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+
+	pin, ok := state.data.Pins[channel]
+	return pin, ok
+}
+
+func (state *State) Pins() map[string]ChannelPin {
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+
+	pins := make(map[string]ChannelPin, len(state.data.Pins))
+	for channel, pin := range state.data.Pins {
+		pins[channel] = pin
+	}
+	return pins
+}
+
+func (state *State) SetPin(channel string, pin ChannelPin) error {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.data.Pins[channel] = pin
+	return state.save()
+}
+
+func (state *State) DeletePin(channel string) error {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	delete(state.data.Pins, channel)
+	return state.save()
+}
+
+// RecordFirstSeen records now as first seen time for all versions of the channel which have not been seen before.
+// If the channel has not been seen at all, the versions are recorded with a zero time, as it is unknown when they
+// were published. Returns the first seen times of the given versions.
+//
+// First seen times are shared by all architectures: a version published for another architecture of the channel
+// later is not recorded again.
+//
+// Nothing is recorded without versions: the upstream returns an empty graph for unknown channels, so channel names
+// given by clients are only stored once the upstream has published releases for them.
+func (state *State) RecordFirstSeen(channel string, versions []string, now time.Time) map[string]time.Time {
+	result := make(map[string]time.Time, len(versions))
+	if len(versions) == 0 {
+		return result
+	}
+
+	state.lock.RLock()
+	seen, known := state.data.FirstSeen[channel]
+	missing := !known
+	for _, version := range versions {
+		firstSeen, ok := seen[version]
+		if !ok {
+			missing = true
+			break
+		}
+		result[version] = firstSeen
+	}
+	state.lock.RUnlock()
+
+	if !missing {
+		return result
+	}
+
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	seen, known = state.data.FirstSeen[channel]
+	if !known {
+		seen = make(map[string]time.Time, len(versions))
+		state.data.FirstSeen[channel] = seen
+	}
+
+	recorded := make([]string, 0)
+	for _, version := range versions {
+		if _, ok := seen[version]; !ok {
+			if known {
+				seen[version] = now
+				recorded = append(recorded, version)
+			} else {
+				seen[version] = time.Time{}
+			}
+		}
+		result[version] = seen[version]
+	}
+
+	if !known {
+		state.logger.Infow("recorded versions of new channel", "channel", channel, "versions", len(versions))
+	} else if len(recorded) > 0 {
+		state.logger.Infow("recorded new versions", "channel", channel, "versions", recorded)
+	}
+
+	state.save()
+	return result
+}
+
+// FirstSeen returns the first seen times of all versions per channel
+func (state *State) FirstSeen() map[string]map[string]time.Time {
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+
+	result := make(map[string]map[string]time.Time, len(state.data.FirstSeen))
+	for channel, seen := range state.data.FirstSeen {
+		result[channel] = make(map[string]time.Time, len(seen))
+		for version, firstSeen := range seen {
+			result[channel][version] = firstSeen
+		}
+	}
+	return result
+}
+
+// ChannelFirstSeen returns the first seen times of all versions of the channel
+func (state *State) ChannelFirstSeen(channel string) map[string]time.Time {
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+
+	seen := state.data.FirstSeen[channel]
+	result := make(map[string]time.Time, len(seen))
+	for version, firstSeen := range seen {
+		result[version] = firstSeen
+	}
+	return result
+}
+
+// Decision returns the decision for the version in the channel. Decisions for all channels apply if the channel
+// has no decision of its own.
+func (state *State) Decision(channel, version string) (Decision, bool) {
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+
+	if decision, ok := state.data.Decisions[decisionKey(channel, version)]; ok {
+		return decision, true
+	}
+	decision, ok := state.data.Decisions[decisionKey("", version)]
+	return decision, ok
+}
+
+func (state *State) Decisions() []Decision {
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+
+	decisions := make([]Decision, 0, len(state.data.Decisions))
+	for _, decision := range state.data.Decisions {
+		decisions = append(decisions, decision)
+	}
+	return decisions
+}
+
+func (state *State) SetDecision(decision Decision) error {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.data.Decisions[decisionKey(decision.Channel, decision.Version)] = decision
+	return state.save()
+}
+
+// DeleteDecision removes the decision, so the release is pending again
+func (state *State) DeleteDecision(channel, version string) error {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	delete(state.data.Decisions, decisionKey(channel, version))
+	return state.save()
+}
+
+func decisionKey(channel, version string) string {
+	return channel + "/" + version
+}
+
+// save must be called with the lock held
+func (state *State) save() error {
+	if !state.Persistent() {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(state.data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = utils.WriteFileAtomic(state.file, data)
+	if err != nil {
+		state.logger.Errorw("cannot write policy state", "file", state.file, "err", err)
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package policy
+
+import (
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordFirstSeen(t *testing.T) {
+	directory := t.TempDir()
+	state, err := NewState(directory, "test", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	// empty graphs of unknown channels are not stored
+	seen := state.RecordFirstSeen("unknown", nil, now)
+	if len(seen) != 0 || len(state.FirstSeen()) != 0 {
+		t.Errorf("recorded channel without versions: %v", state.FirstSeen())
+	}
+	if _, err := os.Stat(filepath.Join(directory, "test.json")); !os.IsNotExist(err) {
+		t.Errorf("state saved for channel without versions: %v", err)
+	}
+
+	// versions of a new channel were published at an unknown time
+	seen = state.RecordFirstSeen("stable-4.14", []string{"4.14.1", "4.14.2"}, now)
+	if len(seen) != 2 || !seen["4.14.1"].IsZero() || !seen["4.14.2"].IsZero() {
+		t.Errorf("expected zero time for versions of new channel, got %v", seen)
+	}
+
+	later := now.Add(time.Hour)
+	seen = state.RecordFirstSeen("stable-4.14", []string{"4.14.1", "4.14.2", "4.14.3"}, later)
+	if !seen["4.14.1"].IsZero() || !seen["4.14.3"].Equal(later) {
+		t.Errorf("unexpected first seen times %v", seen)
+	}
+
+	channel := state.ChannelFirstSeen("stable-4.14")
+	if len(channel) != 3 || !channel["4.14.3"].Equal(later) {
+		t.Errorf("unexpected first seen times of channel %v", channel)
+	}
+	if channel := state.ChannelFirstSeen("unknown"); len(channel) != 0 {
+		t.Errorf("unexpected first seen times of unknown channel %v", channel)
+	}
+
+	// the returned map is a copy
+	channel["4.14.4"] = later
+	if _, ok := state.ChannelFirstSeen("stable-4.14")["4.14.4"]; ok {
+		t.Error("modified state through returned map")
+	}
+
+	restored, err := NewState(directory, "test", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if channel := restored.ChannelFirstSeen("stable-4.14"); len(channel) != 3 || !channel["4.14.3"].Equal(later) {
+		t.Errorf("first seen times not restored: %v", channel)
+	}
+}
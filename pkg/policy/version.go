@@ -0,0 +1,127 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version as used by OpenShift releases, e.g. 4.14.3 or 4.15.0-rc.1
+type Version struct {
+	Major uint64
+	Minor uint64
+	Patch uint64
+	Pre   []string
+}
+
+func ParseVersion(value string) (Version, error) {
+	parts, pre, err := splitVersion(value)
+	if err != nil {
+		return Version{}, err
+	}
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("invalid version %q: expected major.minor.patch", value)
+	}
+
+	version := Version{Pre: pre}
+	numbers := []*uint64{&version.Major, &version.Minor, &version.Patch}
+	for i, part := range parts {
+		*numbers[i], err = strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %q: %w", value, err)
+		}
+	}
+
+	return version, nil
+}
+
+// splitVersion returns the dot separated core components and the pre-release identifiers. Build metadata is dropped.
+func splitVersion(value string) ([]string, []string, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "v")
+	if len(value) == 0 {
+		return nil, nil, fmt.Errorf("empty version")
+	}
+
+	if index := strings.IndexByte(value, '+'); index >= 0 {
+		value = value[:index]
+	}
+
+	var pre []string
+	if index := strings.IndexByte(value, '-'); index >= 0 {
+		pre = strings.Split(value[index+1:], ".")
+		value = value[:index]
+	}
+
+	return strings.Split(value, "."), pre, nil
+}
+
+func (version Version) String() string {
+	value := fmt.Sprintf("%d.%d.%d", version.Major, version.Minor, version.Patch)
+	if len(version.Pre) > 0 {
+		value += "-" + strings.Join(version.Pre, ".")
+	}
+	return value
+}
+
+// Compare returns -1, 0 or 1 if version is lower, equal or greater than other according to semver precedence
+func (version Version) Compare(other Version) int {
+	if c := compareCore(version, other, 3); c != 0 {
+		return c
+	}
+
+	// a version without pre-release has higher precedence
+	switch {
+	case len(version.Pre) == 0 && len(other.Pre) == 0:
+		return 0
+	case len(version.Pre) == 0:
+		return 1
+	case len(other.Pre) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(version.Pre) && i < len(other.Pre); i++ {
+		if c := comparePre(version.Pre[i], other.Pre[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInt(uint64(len(version.Pre)), uint64(len(other.Pre)))
+}
+
+// compareCore compares the first n components of major, minor and patch
+func compareCore(version, other Version, n int) int {
+	a := []uint64{version.Major, version.Minor, version.Patch}
+	b := []uint64{other.Major, other.Minor, other.Patch}
+	for i := 0; i < n; i++ {
+		if c := compareInt(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// comparePre compares pre-release identifiers: numeric identifiers are compared numerically and have lower
+// precedence than alphanumeric ones
+func comparePre(a, b string) int {
+	numA, errA := strconv.ParseUint(a, 10, 64)
+	numB, errB := strconv.ParseUint(b, 10, 64)
+
+	switch {
+	case errA == nil && errB == nil:
+		return compareInt(numA, numB)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInt(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,277 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/lukeelten/openshift-update-proxy/pkg/policy"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	ADMIN_API_PREFIX = "/api/v1/upstreams/"
+
+	// HEADER_REMOTE_USER identifies the operator if the admin API is behind an authenticating proxy
+	HEADER_REMOTE_USER = "X-Remote-User"
+)
+
+type adminError struct {
+	Error string `json:"error"`
+}
+
+type approvalsResponse struct {
+	Pending   []policy.PendingRelease `json:"pending"`
+	Decisions []policy.Decision       `json:"decisions"`
+}
+
+type decisionRequest struct {
+	// Decision is either approved or rejected
+	Decision string `json:"decision"`
+	// Channel the decision applies to, all channels if empty
+	Channel string `json:"channel"`
+	Reason  string `json:"reason"`
+	User    string `json:"user"`
+}
+
+type pinRequest struct {
+	MinVersion string `json:"minVersion"`
+	MaxVersion string `json:"maxVersion"`
+	// User who made the change, defaults to the X-Remote-User header
+	User string `json:"user"`
+}
+
+// newAdminServer creates the server of the admin API:
+//
+//	GET    /api/v1/upstreams/<upstream>/pins            list the version pins of all channels
+//	GET    /api/v1/upstreams/<upstream>/pins/<channel>  get the version pin of a channel
+//	PUT    /api/v1/upstreams/<upstream>/pins/<channel>  set the version pin of a channel
+//	DELETE /api/v1/upstreams/<upstream>/pins/<channel>  remove the runtime pin, the configured pin applies again
+//	GET    /api/v1/upstreams/<upstream>/held            list releases held back by the soak period
+//	GET    /api/v1/upstreams/<upstream>/approvals       list pending releases and all decisions
+//	PUT    /api/v1/upstreams/<upstream>/approvals/<version>  approve or reject a release
+//	DELETE /api/v1/upstreams/<upstream>/approvals/<version>  revoke a decision, the release is pending again
+//	GET    /api/v1/upstreams/<upstream>/cache           list the cache entries with access statistics
+func (proxy *OpenShiftUpdateProxy) newAdminServer() (*http.Server, error) {
+	var token string
+	if len(proxy.Config.Admin.TokenFile) > 0 {
+		data, err := os.ReadFile(proxy.Config.Admin.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read admin token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	} else {
+		proxy.Logger.Warnw("admin API is enabled without authentication", "address", proxy.Config.Admin.Listen)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(ADMIN_API_PREFIX, proxy.adminUpstream)
+
+	return &http.Server{
+		Addr:              proxy.Config.Admin.Listen,
+		Handler:           adminAuth(token, mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}, nil
+}
+
+func adminAuth(token string, next http.Handler) http.Handler {
+	if len(token) == 0 {
+		return next
+	}
+
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(request.Header.Get("Authorization")), expected) != 1 {
+			writeJSON(writer, http.StatusUnauthorized, adminError{Error: "unauthorized"})
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+func (proxy *OpenShiftUpdateProxy) adminUpstream(writer http.ResponseWriter, request *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(request.URL.Path, ADMIN_API_PREFIX), "/"), "/")
+
+	upstreamPolicy, ok := proxy.Policies[parts[0]]
+	if !ok {
+		writeJSON(writer, http.StatusNotFound, adminError{Error: "unknown upstream"})
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && parts[1] == "pins":
+		proxy.adminListPins(writer, request, upstreamPolicy)
+	case len(parts) == 3 && parts[1] == "pins" && len(parts[2]) > 0:
+		proxy.adminPin(writer, request, upstreamPolicy, parts[2])
+	case len(parts) == 2 && parts[1] == "held":
+		proxy.adminListHeld(writer, request, upstreamPolicy)
+	case len(parts) == 2 && parts[1] == "approvals":
+		proxy.adminListApprovals(writer, request, upstreamPolicy)
+	case len(parts) == 3 && parts[1] == "approvals" && len(parts[2]) > 0:
+		proxy.adminDecision(writer, request, upstreamPolicy, parts[2])
+	case len(parts) == 2 && parts[1] == "cache":
+		proxy.adminListCache(writer, request, parts[0])
+	default:
+		writeJSON(writer, http.StatusNotFound, adminError{Error: "not found"})
+	}
+}
+
+func (proxy *OpenShiftUpdateProxy) adminListPins(writer http.ResponseWriter, request *http.Request, upstreamPolicy *policy.UpstreamPolicy) {
+	if request.Method != http.MethodGet {
+		writeJSON(writer, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, upstreamPolicy.Pins().List())
+}
+
+func (proxy *OpenShiftUpdateProxy) adminListCache(writer http.ResponseWriter, request *http.Request, upstream string) {
+	if request.Method != http.MethodGet {
+		writeJSON(writer, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+		return
+	}
+
+	for _, versionClient := range proxy.Clients {
+		if versionClient.Name() == upstream {
+			writeJSON(writer, http.StatusOK, versionClient.Entries())
+			return
+		}
+	}
+	writeJSON(writer, http.StatusNotFound, adminError{Error: "unknown upstream"})
+}
+
+func (proxy *OpenShiftUpdateProxy) adminListHeld(writer http.ResponseWriter, request *http.Request, upstreamPolicy *policy.UpstreamPolicy) {
+	if request.Method != http.MethodGet {
+		writeJSON(writer, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, upstreamPolicy.Soak().Held())
+}
+
+func (proxy *OpenShiftUpdateProxy) adminListApprovals(writer http.ResponseWriter, request *http.Request, upstreamPolicy *policy.UpstreamPolicy) {
+	if request.Method != http.MethodGet {
+		writeJSON(writer, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+		return
+	}
+
+	approval := upstreamPolicy.Approval()
+	writeJSON(writer, http.StatusOK, approvalsResponse{
+		Pending:   approval.Pending(),
+		Decisions: approval.Decisions(),
+	})
+}
+
+func (proxy *OpenShiftUpdateProxy) adminDecision(writer http.ResponseWriter, request *http.Request, upstreamPolicy *policy.UpstreamPolicy, version string) {
+	approval := upstreamPolicy.Approval()
+
+	switch request.Method {
+	case http.MethodPut:
+		var body decisionRequest
+		err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, 1<<16)).Decode(&body)
+		if err != nil {
+			writeJSON(writer, http.StatusBadRequest, adminError{Error: err.Error()})
+			return
+		}
+
+		decision := policy.Decision{
+			Channel:  body.Channel,
+			Version:  version,
+			Decision: body.Decision,
+			User:     adminUser(request, body.User),
+			Reason:   body.Reason,
+			Time:     time.Now().UTC(),
+		}
+		err = approval.Decide(decision)
+		if err != nil {
+			writeJSON(writer, http.StatusBadRequest, adminError{Error: err.Error()})
+			return
+		}
+
+		proxy.Logger.Infow("release decision", "upstream", upstreamPolicy.Name(), "channel", decision.Channel, "version", version, "decision", decision.Decision, "user", decision.User, "reason", decision.Reason)
+		writeJSON(writer, http.StatusOK, decision)
+
+	case http.MethodDelete:
+		channel := request.URL.Query().Get("channel")
+		err := approval.Revoke(channel, version)
+		if err != nil {
+			writeJSON(writer, http.StatusInternalServerError, adminError{Error: err.Error()})
+			return
+		}
+
+		proxy.Logger.Infow("revoked release decision", "upstream", upstreamPolicy.Name(), "channel", channel, "version", version, "user", adminUser(request, ""))
+		writer.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJSON(writer, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+	}
+}
+
+func (proxy *OpenShiftUpdateProxy) adminPin(writer http.ResponseWriter, request *http.Request, upstreamPolicy *policy.UpstreamPolicy, channel string) {
+	pins := upstreamPolicy.Pins()
+
+	switch request.Method {
+	case http.MethodGet:
+		pin, source, ok := pins.Get(channel)
+		if !ok {
+			writeJSON(writer, http.StatusNotFound, adminError{Error: "channel has no pin"})
+			return
+		}
+		writeJSON(writer, http.StatusOK, policy.PinInfo{ChannelPin: pin, Source: source})
+
+	case http.MethodPut:
+		var body pinRequest
+		err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, 1<<16)).Decode(&body)
+		if err != nil {
+			writeJSON(writer, http.StatusBadRequest, adminError{Error: err.Error()})
+			return
+		}
+
+		now := time.Now().UTC()
+		pin := policy.ChannelPin{
+			MinVersion: body.MinVersion,
+			MaxVersion: body.MaxVersion,
+			UpdatedBy:  adminUser(request, body.User),
+			UpdatedAt:  &now,
+		}
+		err = pins.Set(channel, pin)
+		if err != nil {
+			writeJSON(writer, http.StatusBadRequest, adminError{Error: err.Error()})
+			return
+		}
+
+		proxy.Logger.Infow("set version pin", "upstream", upstreamPolicy.Name(), "channel", channel, "minVersion", pin.MinVersion, "maxVersion", pin.MaxVersion, "user", pin.UpdatedBy)
+		writeJSON(writer, http.StatusOK, policy.PinInfo{ChannelPin: pin, Source: policy.PIN_SOURCE_RUNTIME})
+
+	case http.MethodDelete:
+		err := pins.Delete(channel)
+		if err != nil {
+			writeJSON(writer, http.StatusInternalServerError, adminError{Error: err.Error()})
+			return
+		}
+
+		proxy.Logger.Infow("removed version pin", "upstream", upstreamPolicy.Name(), "channel", channel, "user", adminUser(request, ""))
+		writer.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJSON(writer, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+	}
+}
+
+// adminUser returns the user set by an authenticating proxy. The user given in the request body is only used
+// if the header is absent, so clients cannot override the authenticated user.
+func adminUser(request *http.Request, user string) string {
+	remoteUser := request.Header.Get(HEADER_REMOTE_USER)
+	if len(remoteUser) > 0 {
+		return remoteUser
+	}
+	return user
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(value)
+}
@@ -0,0 +1,201 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/lukeelten/openshift-update-proxy/pkg/config"
+	"github.com/lukeelten/openshift-update-proxy/pkg/policy"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testAdminToken = "secret-token"
+
+func newTestAdmin(t *testing.T, token string) http.Handler {
+	t.Helper()
+
+	cfg := &config.UpdateProxyConfig{StateDirectory: t.TempDir()}
+	cfg.Admin.Enabled = true
+	if len(token) > 0 {
+		cfg.Admin.TokenFile = filepath.Join(t.TempDir(), "token")
+		err := os.WriteFile(cfg.Admin.TokenFile, []byte(token+"\n"), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	upstream := config.UpstreamConfig{
+		Name: "test",
+		Policy: config.PolicyConfig{
+			Channels: map[string]config.ChannelPolicyConfig{"stable-4.14": {MinVersion: "4.14.2"}},
+		},
+	}
+	upstreamPolicy, err := policy.NewUpstreamPolicy(upstream, cfg.StateDirectory, nil, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := &OpenShiftUpdateProxy{
+		Config:   cfg,
+		Logger:   zap.NewNop().Sugar(),
+		Policies: map[string]*policy.UpstreamPolicy{"test": upstreamPolicy},
+	}
+
+	server, err := proxy.newAdminServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server.Handler
+}
+
+func adminRequest(t *testing.T, handler http.Handler, method, path, body string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	for name, values := range header {
+		request.Header[name] = values
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAdminAuth(t *testing.T) {
+	handler := newTestAdmin(t, testAdminToken)
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{name: "no token", status: http.StatusUnauthorized},
+		{name: "wrong token", authorization: "Bearer wrong", status: http.StatusUnauthorized},
+		{name: "token without scheme", authorization: testAdminToken, status: http.StatusUnauthorized},
+		{name: "valid token", authorization: "Bearer " + testAdminToken, status: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			if len(test.authorization) > 0 {
+				header.Set("Authorization", test.authorization)
+			}
+
+			response := adminRequest(t, handler, http.MethodGet, "/api/v1/upstreams/test/pins", "", header)
+			if response.Code != test.status {
+				t.Errorf("expected status %d, got %d: %s", test.status, response.Code, response.Body)
+			}
+		})
+	}
+}
+
+func TestAdminWithoutToken(t *testing.T) {
+	handler := newTestAdmin(t, "")
+
+	response := adminRequest(t, handler, http.MethodGet, "/api/v1/upstreams/test/pins", "", nil)
+	if response.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d: %s", response.Code, response.Body)
+	}
+}
+
+func TestAdminPins(t *testing.T) {
+	handler := newTestAdmin(t, "")
+
+	response := adminRequest(t, handler, http.MethodGet, "/api/v1/upstreams/test/pins/stable-4.14", "", nil)
+	var pin policy.PinInfo
+	if err := json.Unmarshal(response.Body.Bytes(), &pin); err != nil || response.Code != http.StatusOK {
+		t.Fatalf("cannot get configured pin: %d %s", response.Code, response.Body)
+	}
+	if pin.Source != policy.PIN_SOURCE_CONFIG || pin.MinVersion != "4.14.2" {
+		t.Errorf("unexpected configured pin %+v", pin)
+	}
+
+	response = adminRequest(t, handler, http.MethodPut, "/api/v1/upstreams/test/pins/stable-4.14", `{"maxVersion": "4.14.5", "user": "alice"}`, nil)
+	if err := json.Unmarshal(response.Body.Bytes(), &pin); err != nil || response.Code != http.StatusOK {
+		t.Fatalf("cannot set pin: %d %s", response.Code, response.Body)
+	}
+	if pin.Source != policy.PIN_SOURCE_RUNTIME || pin.MaxVersion != "4.14.5" || pin.UpdatedBy != "alice" || pin.UpdatedAt == nil {
+		t.Errorf("unexpected runtime pin %+v", pin)
+	}
+
+	// the authenticated user takes precedence over the user in the body
+	header := http.Header{}
+	header.Set(HEADER_REMOTE_USER, "bob")
+	response = adminRequest(t, handler, http.MethodPut, "/api/v1/upstreams/test/pins/stable-4.14", `{"maxVersion": "4.14.6", "user": "alice"}`, header)
+	if err := json.Unmarshal(response.Body.Bytes(), &pin); err != nil || response.Code != http.StatusOK {
+		t.Fatalf("cannot set pin: %d %s", response.Code, response.Body)
+	}
+	if pin.UpdatedBy != "bob" {
+		t.Errorf("expected user from %s header, got %q", HEADER_REMOTE_USER, pin.UpdatedBy)
+	}
+
+	response = adminRequest(t, handler, http.MethodGet, "/api/v1/upstreams/test/pins", "", nil)
+	var pins map[string]policy.PinInfo
+	if err := json.Unmarshal(response.Body.Bytes(), &pins); err != nil || response.Code != http.StatusOK {
+		t.Fatalf("cannot list pins: %d %s", response.Code, response.Body)
+	}
+	if len(pins) != 1 || pins["stable-4.14"].MaxVersion != "4.14.6" {
+		t.Errorf("unexpected pins %+v", pins)
+	}
+
+	response = adminRequest(t, handler, http.MethodDelete, "/api/v1/upstreams/test/pins/stable-4.14", "", nil)
+	if response.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d: %s", response.Code, response.Body)
+	}
+
+	response = adminRequest(t, handler, http.MethodGet, "/api/v1/upstreams/test/pins/stable-4.14", "", nil)
+	if err := json.Unmarshal(response.Body.Bytes(), &pin); err != nil || pin.Source != policy.PIN_SOURCE_CONFIG {
+		t.Errorf("configured pin does not apply after delete: %s", response.Body)
+	}
+}
+
+func TestAdminErrors(t *testing.T) {
+	handler := newTestAdmin(t, "")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "unknown upstream", method: http.MethodGet, path: "/api/v1/upstreams/unknown/pins", status: http.StatusNotFound},
+		{name: "unknown resource", method: http.MethodGet, path: "/api/v1/upstreams/test/unknown", status: http.StatusNotFound},
+		{name: "channel without pin", method: http.MethodGet, path: "/api/v1/upstreams/test/pins/fast-4.14", status: http.StatusNotFound},
+		{name: "invalid json", method: http.MethodPut, path: "/api/v1/upstreams/test/pins/stable-4.14", body: `{"maxVersion":`, status: http.StatusBadRequest},
+		{name: "pin without bounds", method: http.MethodPut, path: "/api/v1/upstreams/test/pins/stable-4.14", body: `{}`, status: http.StatusBadRequest},
+		{name: "invalid version", method: http.MethodPut, path: "/api/v1/upstreams/test/pins/stable-4.14", body: `{"minVersion": "4.14 || 5"}`, status: http.StatusBadRequest},
+		{name: "invalid decision", method: http.MethodPut, path: "/api/v1/upstreams/test/approvals/4.14.3", body: `{"decision": "maybe"}`, status: http.StatusBadRequest},
+		{name: "method not allowed", method: http.MethodPost, path: "/api/v1/upstreams/test/pins", status: http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := adminRequest(t, handler, test.method, test.path, test.body, nil)
+			if response.Code != test.status {
+				t.Errorf("expected status %d, got %d: %s", test.status, response.Code, response.Body)
+			}
+
+			var body adminError
+			if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil || len(body.Error) == 0 {
+				t.Errorf("expected error body, got %s", response.Body)
+			}
+		})
+	}
+}
+
+func TestAdminRequiresStateDirectory(t *testing.T) {
+	cfg := &config.UpdateProxyConfig{}
+	cfg.Admin.Enabled = true
+
+	_, err := NewOpenShiftUpdateProxy(context.Background(), cfg, zap.NewNop().Sugar())
+	if err == nil {
+		t.Error("expected error")
+	}
+}
@@ -2,9 +2,13 @@ package proxy
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/lukeelten/openshift-update-proxy/pkg/client"
 	"github.com/lukeelten/openshift-update-proxy/pkg/config"
 	"github.com/lukeelten/openshift-update-proxy/pkg/metrics"
+	"github.com/lukeelten/openshift-update-proxy/pkg/policy"
+	"github.com/lukeelten/openshift-update-proxy/pkg/utils"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 	"net"
@@ -20,11 +24,21 @@ type OpenShiftUpdateProxy struct {
 
 	Metrics *metrics.UpdateProxyMetrics
 
-	OkdClient       *client.OpenShiftVersionClient
-	OpenShiftClient *client.OpenShiftVersionClient
+	Clients []*client.OpenShiftVersionClient
+
+	// Policies by upstream name
+	Policies map[string]*policy.UpstreamPolicy
+
+	Admin *http.Server
 }
 
-func NewOpenShiftUpdateProxy(cfg *config.UpdateProxyConfig, logger *zap.SugaredLogger) *OpenShiftUpdateProxy {
+// NewOpenShiftUpdateProxy creates the proxy. Cancelling ctx aborts all pending upstream requests.
+func NewOpenShiftUpdateProxy(ctx context.Context, cfg *config.UpdateProxyConfig, logger *zap.SugaredLogger) (*OpenShiftUpdateProxy, error) {
+	if cfg.Admin.Enabled && len(cfg.StateDirectory) == 0 {
+		// changes made through the admin API would be lost on restart
+		return nil, errors.New("admin API requires stateDirectory")
+	}
+
 	m := metrics.NewUpdateProxyMetrics(cfg)
 	mux := http.NewServeMux()
 
@@ -35,9 +49,8 @@ func NewOpenShiftUpdateProxy(cfg *config.UpdateProxyConfig, logger *zap.SugaredL
 			Addr:    cfg.Listen,
 			Handler: mux,
 		},
-		Metrics:         m,
-		OkdClient:       client.NewOpenShiftVersionClient(cfg, m, logger, cfg.OKD.Endpoint, cfg.OKD.Insecure, cfg.OKD.Timeout),
-		OpenShiftClient: client.NewOpenShiftVersionClient(cfg, m, logger, cfg.OCP.Endpoint, cfg.OCP.Insecure, cfg.OCP.Timeout),
+		Metrics:  m,
+		Policies: make(map[string]*policy.UpstreamPolicy),
 	}
 
 	if proxy.Config.Health.Enabled {
@@ -45,10 +58,32 @@ func NewOpenShiftUpdateProxy(cfg *config.UpdateProxyConfig, logger *zap.SugaredL
 		mux.HandleFunc(proxy.Config.Health.Path, proxy.healthCheck)
 	}
 
-	mux.HandleFunc(proxy.Config.OCP.Path, proxy.ocpHandler())
-	mux.HandleFunc(proxy.Config.OKD.Path, proxy.okdHandler())
+	for _, upstream := range cfg.Upstreams {
+		versionClient, err := client.NewOpenShiftVersionClient(ctx, cfg, m, logger, upstream)
+		if err != nil {
+			return nil, err
+		}
+
+		upstreamPolicy, err := policy.NewUpstreamPolicy(upstream, cfg.StateDirectory, m, logger)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy for upstream %s: %w", upstream.Name, err)
+		}
+
+		proxy.Logger.Infow("registered upstream", "upstream", upstream.Name, "path", upstream.Path, "endpoints", upstream.Endpoints)
+		proxy.Clients = append(proxy.Clients, versionClient)
+		proxy.Policies[upstream.Name] = upstreamPolicy
+		mux.HandleFunc(upstream.Path, proxy.handlerFunc(versionClient.Load, upstreamPolicy))
+	}
+
+	if cfg.Admin.Enabled {
+		admin, err := proxy.newAdminServer()
+		if err != nil {
+			return nil, err
+		}
+		proxy.Admin = admin
+	}
 
-	return &proxy
+	return &proxy, nil
 }
 
 func (proxy *OpenShiftUpdateProxy) Run(globalContext context.Context) error {
@@ -72,37 +107,42 @@ func (proxy *OpenShiftUpdateProxy) Run(globalContext context.Context) error {
 		})
 	}
 
-	// OKD
-	group.Go(func() error {
-		for {
-			select {
-			case <-time.NewTimer(proxy.Config.Cache.ControllerCycle).C:
-				proxy.OkdClient.RefreshEntries()
-				proxy.OkdClient.CollectGarbage()
-				continue
-
-			case <-ctx.Done():
-				return nil
-
-			}
-		}
-	})
+	if proxy.Admin != nil {
+		group.Go(func() error {
+			proxy.Logger.Infow("starting admin server", "address", proxy.Admin.Addr)
+			return proxy.Admin.ListenAndServe()
+		})
 
-	// OCP
-	group.Go(func() error {
-		for {
-			select {
-			case <-time.NewTimer(proxy.Config.Cache.ControllerCycle).C:
-				proxy.OpenShiftClient.RefreshEntries()
-				proxy.OpenShiftClient.CollectGarbage()
-				continue
+		group.Go(func() error {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
 
-			case <-ctx.Done():
-				return nil
+			return proxy.Admin.Shutdown(shutdownCtx)
+		})
+	}
 
+	// Refresh loop per upstream
+	for _, versionClient := range proxy.Clients {
+		versionClient := versionClient
+		group.Go(func() error {
+			for {
+				select {
+				case <-time.NewTimer(proxy.Config.Cache.ControllerCycle).C:
+					versionClient.RefreshEntries(ctx)
+					versionClient.CollectGarbage()
+					versionClient.Flush()
+					continue
+
+				case <-ctx.Done():
+					// keep the access statistics of the last cycle across the restart
+					versionClient.Flush()
+					return nil
+
+				}
 			}
-		}
-	})
+		})
+	}
 
 	// Start server
 	group.Go(func() error {
@@ -126,43 +166,66 @@ func (proxy *OpenShiftUpdateProxy) healthCheck(response http.ResponseWriter, req
 	proxy.Logger.Debug("got healthcheck")
 	proxy.Metrics.Healthcheck.Inc()
 
+	// The proxy stays healthy while upstreams are unavailable, as it can still serve cached entries
+	body := "ok\n"
+	for _, versionClient := range proxy.Clients {
+		body += fmt.Sprintf("upstream %s: circuit %s\n", versionClient.Name(), versionClient.CircuitState())
+	}
+
 	response.WriteHeader(http.StatusOK)
-	response.Write([]byte("ok"))
+	response.Write([]byte(body))
 }
 
-func (proxy *OpenShiftUpdateProxy) handlerFunc(loadingFunc func(r *http.Request) ([]byte, error)) http.HandlerFunc {
+// handlerFunc serves the graph loaded by loadingFunc after applying the policy of the upstream
+func (proxy *OpenShiftUpdateProxy) handlerFunc(loadingFunc func(r *http.Request) (client.VersionEntry, error), upstreamPolicy *policy.UpstreamPolicy) http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		startTime := time.Now()
 		defer func() {
 			proxy.Metrics.ResponseTime.WithLabelValues(request.URL.Path).Observe(float64(time.Since(startTime).Microseconds()))
 		}()
 
-		body, err := loadingFunc(request)
+		entry, err := loadingFunc(request)
+
+		if err != nil && request.Context().Err() != nil {
+			// the client has gone away, nobody is left to receive the response
+			proxy.Logger.Debugw("request cancelled", "url", request.URL.String(), "err", err)
+			return
+		}
 
 		if err != nil {
 			proxy.Metrics.ErrorResponses.WithLabelValues(request.URL.Path).Inc()
-			proxy.Logger.Debugw("error when loading version info", "request", request, "err", err)
+			proxy.Logger.Debugw("error when loading version info", "url", request.URL.String(), "err", err)
 			proxy.Logger.Errorw("error when loading version info", "err", err)
 			writer.WriteHeader(http.StatusInternalServerError)
 			writer.Write([]byte(err.Error()))
 			return
 		}
 
+		arch, channel, version := utils.ExtractQueryParams(request)
+		body, err := upstreamPolicy.Apply(policy.Request{Arch: arch, Channel: channel, Version: version}, entry.Body)
+		if err != nil {
+			// never serve a graph the policy could not be applied to, it may contain blocked releases
+			proxy.Metrics.ErrorResponses.WithLabelValues(request.URL.Path).Inc()
+			proxy.Logger.Errorw("cannot apply policy to graph", "arch", arch, "channel", channel, "version", version, "err", err)
+			writer.WriteHeader(http.StatusInternalServerError)
+			writer.Write([]byte("cannot apply policy to graph"))
+			return
+		}
+
+		if entry.StaleReason == client.STALE_REASON_ERROR {
+			writer.Header().Set(utils.HEADER_STALE, "true")
+		}
+		if len(entry.Endpoint) > 0 {
+			writer.Header().Set(utils.HEADER_ENDPOINT, entry.Endpoint)
+		}
+
 		writer.WriteHeader(http.StatusOK)
 		_, err = writer.Write(body)
 
 		if err != nil {
-			proxy.Logger.Debugw("got error when writing response", "request", request, "err", err, "body", body)
+			proxy.Logger.Debugw("got error when writing response", "url", request.URL.String(), "err", err)
 			proxy.Logger.Errorw("error writing response", "err", err)
 			proxy.Metrics.ErrorResponses.WithLabelValues(request.URL.Path).Inc()
 		}
 	}
 }
-
-func (proxy *OpenShiftUpdateProxy) okdHandler() http.HandlerFunc {
-	return proxy.handlerFunc(proxy.OkdClient.Load)
-}
-
-func (proxy *OpenShiftUpdateProxy) ocpHandler() http.HandlerFunc {
-	return proxy.handlerFunc(proxy.OpenShiftClient.Load)
-}
@@ -12,6 +12,11 @@ func hash(key string) string {
 	return fmt.Sprintf("%x", sum)
 }
 
+// ContentHash returns a hash identifying the content of a body
+func ContentHash(body []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(body))
+}
+
 func MakeKey(arch, channel, version string) string {
 	return hash(MakeQueryString(arch, channel, version))
 }
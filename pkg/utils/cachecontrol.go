@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FreshnessLifetime calculates the remaining freshness of a response from its Cache-Control, Expires and Age headers
+// as described in RFC 9111. The proxy is treated as shared cache, so s-maxage takes precedence over max-age.
+// Returns false if the response carries no freshness information.
+func FreshnessLifetime(header http.Header, now time.Time) (time.Duration, bool) {
+	lifetime, ok := cacheControlLifetime(header.Values("Cache-Control"))
+
+	if !ok {
+		expires := header.Get("Expires")
+		if len(expires) == 0 {
+			return 0, false
+		}
+
+		expiresTime, err := http.ParseTime(expires)
+		if err != nil {
+			// invalid Expires values represent a time in the past
+			return 0, true
+		}
+
+		date := now
+		if dateTime, err := http.ParseTime(header.Get("Date")); err == nil {
+			date = dateTime
+		}
+
+		lifetime = expiresTime.Sub(date)
+	}
+
+	if age, err := strconv.ParseInt(strings.TrimSpace(header.Get("Age")), 10, 64); err == nil && age > 0 {
+		lifetime -= time.Duration(age) * time.Second
+	}
+
+	if lifetime < 0 {
+		lifetime = 0
+	}
+
+	return lifetime, true
+}
+
+func cacheControlLifetime(values []string) (time.Duration, bool) {
+	maxAge := int64(-1)
+	sharedMaxAge := int64(-1)
+
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			arg = strings.Trim(strings.TrimSpace(arg), `"`)
+
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "no-store", "no-cache":
+				return 0, true
+
+			case "max-age":
+				if seconds, err := strconv.ParseInt(arg, 10, 64); err == nil && seconds >= 0 {
+					maxAge = seconds
+				}
+
+			case "s-maxage":
+				if seconds, err := strconv.ParseInt(arg, 10, 64); err == nil && seconds >= 0 {
+					sharedMaxAge = seconds
+				}
+			}
+		}
+	}
+
+	if sharedMaxAge >= 0 {
+		return time.Duration(sharedMaxAge) * time.Second, true
+	}
+	if maxAge >= 0 {
+		return time.Duration(maxAge) * time.Second, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFreshnessLifetime(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		header   map[string][]string
+		lifetime time.Duration
+		ok       bool
+	}{
+		{name: "no freshness information", header: map[string][]string{}},
+		{name: "max-age", header: map[string][]string{"Cache-Control": {"public, max-age=300"}}, lifetime: 5 * time.Minute, ok: true},
+		{name: "s-maxage over max-age", header: map[string][]string{"Cache-Control": {"max-age=300, s-maxage=60"}}, lifetime: time.Minute, ok: true},
+		{name: "s-maxage before max-age", header: map[string][]string{"Cache-Control": {"s-maxage=60", "max-age=300"}}, lifetime: time.Minute, ok: true},
+		{name: "quoted max-age", header: map[string][]string{"Cache-Control": {`max-age="120"`}}, lifetime: 2 * time.Minute, ok: true},
+		{name: "uppercase directive", header: map[string][]string{"Cache-Control": {"MAX-AGE=120"}}, lifetime: 2 * time.Minute, ok: true},
+		{name: "invalid max-age", header: map[string][]string{"Cache-Control": {"max-age=abc"}}},
+		{name: "negative max-age", header: map[string][]string{"Cache-Control": {"max-age=-1"}}},
+		{name: "no-store", header: map[string][]string{"Cache-Control": {"max-age=300, no-store"}}, lifetime: 0, ok: true},
+		{name: "no-cache", header: map[string][]string{"Cache-Control": {"no-cache"}}, lifetime: 0, ok: true},
+		{name: "max-age=0", header: map[string][]string{"Cache-Control": {"max-age=0"}}, lifetime: 0, ok: true},
+		{
+			name:     "max-age over Expires",
+			header:   map[string][]string{"Cache-Control": {"max-age=60"}, "Expires": {now.Add(time.Hour).Format(http.TimeFormat)}},
+			lifetime: time.Minute,
+			ok:       true,
+		},
+		{
+			name:     "Expires minus Date",
+			header:   map[string][]string{"Expires": {now.Add(time.Hour).Format(http.TimeFormat)}, "Date": {now.Add(-time.Hour).Format(http.TimeFormat)}},
+			lifetime: 2 * time.Hour,
+			ok:       true,
+		},
+		{
+			name:     "Expires without Date",
+			header:   map[string][]string{"Expires": {now.Add(time.Hour).Format(http.TimeFormat)}},
+			lifetime: time.Hour,
+			ok:       true,
+		},
+		{
+			name:     "Expires in the past",
+			header:   map[string][]string{"Expires": {now.Add(-time.Hour).Format(http.TimeFormat)}},
+			lifetime: 0,
+			ok:       true,
+		},
+		{name: "invalid Expires", header: map[string][]string{"Expires": {"0"}}, lifetime: 0, ok: true},
+		{name: "Age", header: map[string][]string{"Cache-Control": {"max-age=300"}, "Age": {"100"}}, lifetime: 200 * time.Second, ok: true},
+		{name: "Age exceeds max-age", header: map[string][]string{"Cache-Control": {"max-age=300"}, "Age": {"400"}}, lifetime: 0, ok: true},
+		{name: "invalid Age", header: map[string][]string{"Cache-Control": {"max-age=300"}, "Age": {"abc"}}, lifetime: 5 * time.Minute, ok: true},
+		{
+			name:     "Age with Expires",
+			header:   map[string][]string{"Expires": {now.Add(time.Hour).Format(http.TimeFormat)}, "Date": {now.Format(http.TimeFormat)}, "Age": {"600"}},
+			lifetime: 50 * time.Minute,
+			ok:       true,
+		},
+		{name: "Age without freshness information", header: map[string][]string{"Age": {"100"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			for name, values := range test.header {
+				for _, value := range values {
+					header.Add(name, value)
+				}
+			}
+
+			lifetime, ok := FreshnessLifetime(header, now)
+			if lifetime != test.lifetime || ok != test.ok {
+				t.Errorf("expected %v (%v), got %v (%v)", test.lifetime, test.ok, lifetime, ok)
+			}
+		})
+	}
+}
@@ -5,7 +5,8 @@ import (
 )
 
 var (
-	ERR_NOT_FOUND = errors.New("cannot find entry in cache")
+	ERR_NOT_FOUND    = errors.New("cannot find entry in cache")
+	ERR_CIRCUIT_OPEN = errors.New("upstream unavailable, circuit breaker open")
 )
 
 const (
@@ -13,4 +14,9 @@ const (
 	QUERY_PARAM_CHANNEL = "channel"
 	QUERY_PARAM_VERSION = "version"
 	METRIC_NAMESPACE    = "openshift_update_proxy"
+
+	// HEADER_STALE is set on responses which are served from an expired cache entry because the upstream is failing
+	HEADER_STALE = "X-Update-Proxy-Stale"
+	// HEADER_ENDPOINT names the upstream endpoint which served the graph
+	HEADER_ENDPOINT = "X-Update-Proxy-Endpoint"
 )
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes to a temporary file first and renames it afterwards, so a crash never leaves a
+// partially written file behind.
+func WriteFileAtomic(name string, data []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmpFile.Write(data)
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), name)
+	}
+
+	if err != nil {
+		os.Remove(tmpFile.Name())
+	}
+	return err
+}